@@ -0,0 +1,236 @@
+package vitali
+
+import (
+    "io"
+    "net"
+    "sync"
+    "time"
+    "path"
+    "bytes"
+    "strings"
+    "strconv"
+    "net/http"
+    "math/rand"
+    "text/template"
+    "encoding/json"
+)
+
+const (
+    // the NCSA Common Log Format
+    CommonLogFormat = `{{dash .RemoteAddr}} - {{dash .User}} [{{clfTime .Time}}] "{{escape .Method}} {{escape .RequestURI}} {{.Proto}}" {{.Status}} {{clfBytes .Bytes}}`
+    // the NCSA Combined Log Format, with the referer and the user agent
+    CombinedLogFormat = CommonLogFormat + ` "{{escape .Referer}}" "{{escape .UserAgent}}"`
+    // one JSON object per line
+    JSONLogFormat = "json"
+)
+
+// AccessRecord is the access log record of a request.
+type AccessRecord struct {
+    Time time.Time
+    RemoteAddr string
+    Method string
+    Path string
+    RequestURI string
+    Proto string
+    Route string
+    Status int
+    Bytes int
+    Duration time.Duration
+    User string
+    RequestID string
+    Referer string
+    UserAgent string
+    Code uint32
+    Error string
+}
+
+func (c AccessRecord) MarshalJSON() ([]byte, error) {
+    m := map[string]interface{}{
+        "time": c.Time.Format(time.RFC3339Nano),
+        "remote": c.RemoteAddr,
+        "method": c.Method,
+        "path": c.Path,
+        "uri": c.RequestURI,
+        "proto": c.Proto,
+        "route": c.Route,
+        "status": c.Status,
+        "bytes": c.Bytes,
+        "duration_ms": float64(c.Duration) / float64(time.Millisecond),
+        "user": c.User,
+        "request_id": c.RequestID,
+        "referer": c.Referer,
+        "user_agent": c.UserAgent,
+    }
+    if c.Error != "" {
+        m["code"] = c.Code
+        m["error"] = c.Error
+    }
+    return json.Marshal(m)
+}
+
+// AccessLog writes the access records in Format, which is CommonLogFormat,
+// CombinedLogFormat, JSONLogFormat or a text/template executed with the
+// AccessRecord, to Writer. The requests to the paths matching ExcludePaths
+// by path.Match, or skipped by Skip, are not logged. If SampleRate is between
+// 0 and 1, only that fraction of the responses below 500 are logged.
+type AccessLog struct {
+    Writer io.Writer
+    Format string
+    ExcludePaths []string
+    Skip func(record *AccessRecord) bool
+    SampleRate float64
+
+    once sync.Once
+    tmpl *template.Template
+    err error
+    mutex sync.Mutex
+}
+
+// CreateAccessLog returns an AccessLog writing the records in format to w.
+// It panics if format is not a valid template.
+func CreateAccessLog(w io.Writer, format string) *AccessLog {
+    c := &AccessLog{Writer: w, Format: format}
+    if _, err := c.template(); err != nil {
+        panic(err)
+    }
+    return c
+}
+
+var accessLogFuncs = template.FuncMap{
+    "dash": func(s string) string {
+        if s == "" {
+            return "-"
+        }
+        return s
+    },
+    "escape": func(s string) string {
+        quoted := strconv.Quote(s)
+        return quoted[1:len(quoted)-1]
+    },
+    "clfTime": func(t time.Time) string {
+        return t.Format("02/Jan/2006:15:04:05 -0700")
+    },
+    "clfBytes": func(n int) string {
+        if n == 0 {
+            return "-"
+        }
+        return strconv.Itoa(n)
+    },
+}
+
+// template returns the template of Format, or nil for JSONLogFormat. The
+// error parsing Format is kept and returned for every record.
+func (c *AccessLog) template() (*template.Template, error) {
+    c.once.Do(func() {
+        if c.Format != JSONLogFormat {
+            format := c.Format
+            if format == "" {
+                format = CommonLogFormat
+            }
+            c.tmpl, c.err = template.New("access").Funcs(accessLogFuncs).Parse(format)
+        }
+    })
+    return c.tmpl, c.err
+}
+
+func (c *AccessLog) skipped(record *AccessRecord) bool {
+    for _, pattern := range c.ExcludePaths {
+        if matched, _ := path.Match(pattern, record.Path); matched {
+            return true
+        }
+    }
+    if c.Skip != nil && c.Skip(record) {
+        return true
+    }
+    return c.SampleRate > 0 && c.SampleRate < 1 && record.Status < 500 &&
+        rand.Float64() >= c.SampleRate
+}
+
+func (c *AccessLog) write(record *AccessRecord) error {
+    if c.skipped(record) {
+        return nil
+    }
+    tmpl, err := c.template()
+    if err != nil {
+        return err
+    }
+    buf := &bytes.Buffer{}
+    if tmpl != nil {
+        err = tmpl.Execute(buf, record)
+        if err != nil {
+            return err
+        }
+    } else {
+        err = json.NewEncoder(buf).Encode(record)
+        if err != nil {
+            return err
+        }
+        buf.Truncate(buf.Len()-1)
+    }
+    buf.WriteByte('\n')
+
+    c.mutex.Lock()
+    defer c.mutex.Unlock()
+    _, err = c.Writer.Write(buf.Bytes())
+    return err
+}
+
+// isTrustedProxy tells if the address is in the TrustedProxies, which are
+// IP addresses or CIDR ranges.
+func (c *webApp) isTrustedProxy(addr string) bool {
+    ip := net.ParseIP(addr)
+    if ip == nil {
+        return false
+    }
+    for _, proxy := range c.TrustedProxies {
+        if strings.Contains(proxy, "/") {
+            _, ipNet, err := net.ParseCIDR(proxy)
+            if err == nil && ipNet.Contains(ip) {
+                return true
+            }
+        } else if proxyIP := net.ParseIP(proxy); proxyIP != nil && proxyIP.Equal(ip) {
+            return true
+        }
+    }
+    return false
+}
+
+// clientAddr returns the address of the client. The X-Forwarded-For header is
+// only honored if the request comes from a trusted proxy, in which case the
+// last address not of a trusted proxy is the client.
+func (c *webApp) clientAddr(r *http.Request) string {
+    host := remoteHost(r)
+    if !c.isTrustedProxy(host) {
+        return host
+    }
+    forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+    for i := len(forwarded) - 1; i >= 0; i-- {
+        addr := strings.TrimSpace(forwarded[i])
+        if addr == "" {
+            continue
+        }
+        if !c.isTrustedProxy(addr) {
+            return addr
+        }
+        host = addr
+    }
+    return host
+}
+
+// remoteHost returns the address of the connection without the port.
+func remoteHost(r *http.Request) string {
+    host, _, err := net.SplitHostPort(r.RemoteAddr)
+    if err != nil {
+        return r.RemoteAddr
+    }
+    return host
+}
+
+// ClientAddr returns the IP address of the client, as forwarded by the
+// TrustedProxies.
+func (c *Ctx) ClientAddr() string {
+    if c.app == nil {
+        return remoteHost(c.Request)
+    }
+    return c.app.clientAddr(c.Request)
+}
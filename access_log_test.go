@@ -0,0 +1,128 @@
+package vitali
+
+import (
+    "bytes"
+    "testing"
+    "strings"
+    "net/http"
+    "encoding/json"
+    "net/http/httptest"
+)
+
+func TestAccessLogFormats(t *testing.T) {
+    webapp := CreateWebApp([]RouteRule{
+        {"/something/{id1}", Something{}},
+        {"/panic", Panikr{}},
+    })
+    webapp.Logger = &recordLogger{}
+    buf := &bytes.Buffer{}
+    request := func(path string) {
+        r := httptest.NewRequest("GET", path, nil)
+        r.RemoteAddr = "10.0.0.1:1234"
+        r.Header.Set("Referer", "http://lunastorm.tw/")
+        r.Header.Set("User-Agent", `curl "7"`)
+        webapp.ServeHTTP(httptest.NewRecorder(), r)
+    }
+
+    webapp.AccessLog = CreateAccessLog(buf, CombinedLogFormat)
+    request("/something/foo?x=1")
+    line := buf.String()
+    if !strings.HasPrefix(line, "10.0.0.1 - - [") ||
+            !strings.HasSuffix(line, `] "GET /something/foo?x=1 HTTP/1.1" 200 3 "http://lunastorm.tw/" "curl \"7\""`+"\n") {
+        t.Errorf("combined log is `%s`", line)
+    }
+
+    buf.Reset()
+    webapp.AccessLog = CreateAccessLog(buf, JSONLogFormat)
+    request("/panic")
+    var record map[string]interface{}
+    err := json.Unmarshal(buf.Bytes(), &record)
+    if err != nil || record["status"] != float64(500) || record["route"] != "/panic" ||
+            record["code"] != float64(errorCode("panic!!")) {
+        t.Errorf("json log is `%s`", buf.String())
+    }
+    if logger := webapp.Logger.(*recordLogger); len(logger.records) != 1 ||
+            logger.records[0].level != LevelError {
+        t.Errorf("records are %v", logger.records)
+    }
+
+    buf.Reset()
+    webapp.AccessLog = CreateAccessLog(buf, "{{.Method}} {{.Route}} {{.Status}}")
+    webapp.AccessLog.ExcludePaths = []string{"/something/ba*"}
+    webapp.AccessLog.SampleRate = 0.000001
+    request("/something/bar")
+    request("/something/foo")
+    request("/panic")
+    if buf.String() != "GET /panic 500\n" {
+        t.Errorf("custom log is `%s`", buf.String())
+    }
+}
+
+func TestTrustedProxies(t *testing.T) {
+    webapp := CreateWebApp([]RouteRule{})
+    clientAddr := func(remoteAddr string, forwarded ...string) string {
+        r := httptest.NewRequest("GET", "/", nil)
+        r.RemoteAddr = remoteAddr
+        for _, f := range forwarded {
+            r.Header.Add("X-Forwarded-For", f)
+        }
+        return webapp.clientAddr(r)
+    }
+
+    if addr := clientAddr("10.0.0.1:1234", "1.2.3.4"); addr != "10.0.0.1" {
+        t.Errorf("untrusted proxy gives %s", addr)
+    }
+    webapp.TrustedProxies = []string{"10.0.0.0/8", "192.168.1.1"}
+    tests := []struct {
+        remoteAddr string
+        forwarded []string
+        addr string
+    }{
+        {"10.0.0.1:1234", []string{"1.2.3.4"}, "1.2.3.4"},
+        {"10.0.0.1:1234", []string{"6.6.6.6, 1.2.3.4", "192.168.1.1"}, "1.2.3.4"},
+        {"10.0.0.1:1234", []string{"10.1.1.1"}, "10.1.1.1"},
+        {"10.0.0.1:1234", nil, "10.0.0.1"},
+        {"5.5.5.5:1234", []string{"1.2.3.4"}, "5.5.5.5"},
+    }
+    for _, test := range tests {
+        if addr := clientAddr(test.remoteAddr, test.forwarded...); addr != test.addr {
+            t.Errorf("%s %v gives %s", test.remoteAddr, test.forwarded, addr)
+        }
+    }
+}
+
+func TestAccessLogInvalidFormat(t *testing.T) {
+    webapp := CreateWebApp([]RouteRule{
+        {"/something/{id1}", Something{}},
+    })
+    logger := &recordLogger{}
+    webapp.Logger = logger
+    buf := &bytes.Buffer{}
+    webapp.AccessLog = &AccessLog{Writer: buf, Format: "{{.Method"}
+    if webapp.Validate() == nil {
+        t.Errorf("invalid format is valid")
+    }
+    rr := httptest.NewRecorder()
+    webapp.ServeHTTP(rr, httptest.NewRequest("GET", "/something/foo", nil))
+    if rr.Code != http.StatusInternalServerError {
+        t.Errorf("response code is %d", rr.Code)
+    }
+    if buf.Len() != 0 {
+        t.Errorf("access log is `%s`", buf.String())
+    }
+    failed := false
+    for _, record := range logger.records {
+        failed = failed || record.msg == "failed to write access log"
+    }
+    if !failed {
+        t.Errorf("records are %v", logger.records)
+    }
+}
+
+func TestClientAddrWithoutApp(t *testing.T) {
+    r := httptest.NewRequest("GET", "/", nil)
+    r.RemoteAddr = "10.0.0.1:1234"
+    if addr := (&Ctx{Request: r}).ClientAddr(); addr != "10.0.0.1" {
+        t.Errorf("client address is %s", addr)
+    }
+}
@@ -0,0 +1,254 @@
+package vitali
+
+import (
+    "time"
+    "sync"
+    "bytes"
+    "errors"
+    "strings"
+    "net/http"
+    "crypto/hmac"
+    "crypto/sha256"
+    "crypto/sha512"
+    "crypto/ed25519"
+    "encoding/json"
+    "encoding/base64"
+    "hash"
+)
+
+// BearerUserProvider authenticates the requests with a JWT in the
+// "Authorization: Bearer" header, signed by HS256, HS384, HS512 or EdDSA
+// (Ed25519) with one of the keys added. The key is chosen by the kid of the
+// token header if any, so that keys can be rotated. The exp and nbf claims are
+// checked with Leeway, and so are iss and aud if Issuer and Audience are set.
+// The tokens without exp never expire unless RequireExp is set. The user is
+// read from the UserClaim claim, and the roles from the RolesClaim claim as an
+// array or a space separated string. The keys can be added while serving.
+type BearerUserProvider struct {
+    Realm string
+    Issuer string
+    Audience string
+    UserClaim string
+    RolesClaim string
+    Leeway time.Duration
+    RequireExp bool
+
+    lock sync.RWMutex
+    hmacKeys map[string][]byte
+    ed25519Keys map[string]ed25519.PublicKey
+}
+
+func CreateBearerUserProvider(realm string) *BearerUserProvider {
+    return &BearerUserProvider{
+        Realm: realm,
+        UserClaim: "sub",
+        RolesClaim: "roles",
+        Leeway: time.Minute,
+        hmacKeys: make(map[string][]byte),
+        ed25519Keys: make(map[string]ed25519.PublicKey),
+    }
+}
+
+func (c *BearerUserProvider) AddHMACKey(kid string, secret []byte) {
+    c.lock.Lock()
+    defer c.lock.Unlock()
+    c.hmacKeys[kid] = secret
+}
+
+// AddEd25519Key adds the public key, and panics if it is not of
+// ed25519.PublicKeySize bytes.
+func (c *BearerUserProvider) AddEd25519Key(kid string, key ed25519.PublicKey) {
+    if len(key) != ed25519.PublicKeySize {
+        panic("vitali: invalid Ed25519 public key size")
+    }
+    c.lock.Lock()
+    defer c.lock.Unlock()
+    c.ed25519Keys[kid] = key
+}
+
+var errNoBearerToken = errors.New("no bearer token")
+
+func bearerToken(r *http.Request) (string, error) {
+    parts := strings.SplitN(r.Header.Get("Authorization"), " ", 2)
+    if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") {
+        return "", errNoBearerToken
+    }
+    return strings.TrimSpace(parts[1]), nil
+}
+
+func (c *BearerUserProvider) AuthHeader(r *http.Request) string {
+    header := `Bearer realm="` + quoteParam(c.Realm) + `"`
+    token, err := bearerToken(r)
+    if err == nil {
+        _, err = c.Verify(token)
+    }
+    if err != nil && err != errNoBearerToken {
+        header += `, error="invalid_token", error_description="` + quoteParam(err.Error()) + `"`
+    }
+    return header
+}
+
+func quoteParam(s string) string {
+    return strings.Replace(strings.Replace(s, `\`, `\\`, -1), `"`, `\"`, -1)
+}
+
+func (c *BearerUserProvider) AuthScheme() string {
+    return "Bearer"
+}
+
+func (c *BearerUserProvider) GetUserAndRoles(r *http.Request) (string, []string) {
+    token, err := bearerToken(r)
+    if err != nil {
+        return "", []string{}
+    }
+    claims, err := c.Verify(token)
+    if err != nil {
+        return "", []string{}
+    }
+
+    user, _ := claims[c.UserClaim].(string)
+    roles := []string{}
+    switch v := claims[c.RolesClaim].(type) {
+    case string:
+        roles = strings.Fields(v)
+    case []interface{}:
+        for _, role := range v {
+            if s, ok := role.(string); ok {
+                roles = append(roles, s)
+            }
+        }
+    }
+    return user, roles
+}
+
+// Verify checks the signature and the claims of the token, and returns the
+// claims.
+func (c *BearerUserProvider) Verify(token string) (map[string]interface{}, error) {
+    parts := strings.Split(token, ".")
+    if len(parts) != 3 {
+        return nil, errors.New("malformed token")
+    }
+    var header struct {
+        Alg string `json:"alg"`
+        Kid string `json:"kid"`
+    }
+    content, err := base64.RawURLEncoding.DecodeString(parts[0])
+    if err == nil {
+        err = json.Unmarshal(content, &header)
+    }
+    if err != nil {
+        return nil, errors.New("malformed token header")
+    }
+    signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+    if err != nil {
+        return nil, errors.New("malformed token signature")
+    }
+
+    signed := []byte(parts[0] + "." + parts[1])
+    if !c.verifySignature(header.Alg, header.Kid, signed, signature) {
+        return nil, errors.New("invalid signature")
+    }
+
+    claims := make(map[string]interface{})
+    content, err = base64.RawURLEncoding.DecodeString(parts[1])
+    if err == nil {
+        decoder := json.NewDecoder(bytes.NewReader(content))
+        decoder.UseNumber()
+        err = decoder.Decode(&claims)
+    }
+    if err != nil {
+        return nil, errors.New("malformed token claims")
+    }
+    return claims, c.checkClaims(claims)
+}
+
+func (c *BearerUserProvider) verifySignature(alg string, kid string, signed []byte, signature []byte) bool {
+    c.lock.RLock()
+    defer c.lock.RUnlock()
+    var hashFunc func() hash.Hash
+    switch alg {
+    case "HS256":
+        hashFunc = sha256.New
+    case "HS384":
+        hashFunc = sha512.New384
+    case "HS512":
+        hashFunc = sha512.New
+    case "EdDSA":
+        for k, key := range c.ed25519Keys {
+            if (kid == "" || k == kid) && ed25519.Verify(key, signed, signature) {
+                return true
+            }
+        }
+        return false
+    default:
+        return false
+    }
+
+    for k, secret := range c.hmacKeys {
+        if kid != "" && k != kid {
+            continue
+        }
+        mac := hmac.New(hashFunc, secret)
+        mac.Write(signed)
+        if hmac.Equal(mac.Sum(nil), signature) {
+            return true
+        }
+    }
+    return false
+}
+
+func (c *BearerUserProvider) checkClaims(claims map[string]interface{}) error {
+    now := time.Now()
+    if exp, ok := claims["exp"]; ok {
+        t, err := numericDate(exp)
+        if err != nil {
+            return err
+        }
+        if now.After(t.Add(c.Leeway)) {
+            return errors.New("token is expired")
+        }
+    } else if c.RequireExp {
+        return errors.New("token has no expiry")
+    }
+    if nbf, ok := claims["nbf"]; ok {
+        t, err := numericDate(nbf)
+        if err != nil {
+            return err
+        }
+        if now.Add(c.Leeway).Before(t) {
+            return errors.New("token is not valid yet")
+        }
+    }
+    if c.Issuer != "" && claims["iss"] != c.Issuer {
+        return errors.New("invalid issuer")
+    }
+    if c.Audience != "" {
+        found := false
+        switch aud := claims["aud"].(type) {
+        case string:
+            found = aud == c.Audience
+        case []interface{}:
+            for _, a := range aud {
+                if a == c.Audience {
+                    found = true
+                }
+            }
+        }
+        if !found {
+            return errors.New("invalid audience")
+        }
+    }
+    return nil
+}
+
+func numericDate(v interface{}) (time.Time, error) {
+    n, ok := v.(json.Number)
+    if !ok {
+        return time.Time{}, errors.New("invalid date claim")
+    }
+    f, err := n.Float64()
+    if err != nil {
+        return time.Time{}, errors.New("invalid date claim")
+    }
+    return time.Unix(int64(f), 0), nil
+}
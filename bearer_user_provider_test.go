@@ -0,0 +1,149 @@
+package vitali
+
+import (
+    "time"
+    "strconv"
+    "strings"
+    "testing"
+    "crypto/hmac"
+    "crypto/sha256"
+    "crypto/ed25519"
+    "encoding/json"
+    "encoding/base64"
+)
+
+func signTestToken(header map[string]interface{}, claims map[string]interface{},
+        sign func([]byte) []byte) string {
+    h, _ := json.Marshal(header)
+    c, _ := json.Marshal(claims)
+    signed := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(c)
+    return signed + "." + base64.RawURLEncoding.EncodeToString(sign([]byte(signed)))
+}
+
+func hs256(secret string) func([]byte) []byte {
+    return func(data []byte) []byte {
+        mac := hmac.New(sha256.New, []byte(secret))
+        mac.Write(data)
+        return mac.Sum(nil)
+    }
+}
+
+func TestBearerUserProvider(t *testing.T) {
+    pub, priv, _ := ed25519.GenerateKey(nil)
+    provider := CreateBearerUserProvider("api")
+    provider.Issuer = "https://issuer"
+    provider.Audience = "vitali"
+    provider.AddHMACKey("old", []byte("old secret"))
+    provider.AddHMACKey("new", []byte("new secret"))
+    provider.AddEd25519Key("ed", pub)
+    edSign := func(data []byte) []byte {
+        return ed25519.Sign(priv, data)
+    }
+
+    now := time.Now().Unix()
+    claims := func(extra map[string]interface{}) map[string]interface{} {
+        c := map[string]interface{}{
+            "sub": "alice",
+            "iss": "https://issuer",
+            "aud": []string{"other", "vitali"},
+            "exp": now + 60,
+            "roles": []string{"AUTHED", "ADMIN"},
+        }
+        for k, v := range extra {
+            c[k] = v
+        }
+        return c
+    }
+    hsHeader := func(kid string) map[string]interface{} {
+        return map[string]interface{}{"alg": "HS256", "typ": "JWT", "kid": kid}
+    }
+
+    tests := []struct {
+        token string
+        user string
+        roles int
+        err string
+    }{
+        {signTestToken(hsHeader("new"), claims(nil), hs256("new secret")), "alice", 2, ""},
+        {signTestToken(hsHeader("old"), claims(nil), hs256("old secret")), "alice", 2, ""},
+        {signTestToken(hsHeader(""), claims(nil), hs256("old secret")), "alice", 2, ""},
+        {signTestToken(map[string]interface{}{"alg": "EdDSA", "kid": "ed"},
+            claims(map[string]interface{}{"roles": "AUTHED ADMIN"}), edSign), "alice", 2, ""},
+        {signTestToken(hsHeader("new"), claims(nil), hs256("old secret")), "", 0, "invalid signature"},
+        {signTestToken(hsHeader("new"), claims(nil), hs256("wrong")), "", 0, "invalid signature"},
+        {signTestToken(map[string]interface{}{"alg": "none"}, claims(nil),
+            func([]byte) []byte { return nil }), "", 0, "invalid signature"},
+        {signTestToken(map[string]interface{}{"alg": "HS256", "kid": "ed"}, claims(nil),
+            hs256(string(pub))), "", 0, "invalid signature"},
+        {signTestToken(hsHeader("new"), claims(map[string]interface{}{"exp": now - 3600}),
+            hs256("new secret")), "", 0, "token is expired"},
+        {signTestToken(hsHeader("new"), claims(map[string]interface{}{"nbf": now + 3600}),
+            hs256("new secret")), "", 0, "token is not valid yet"},
+        {signTestToken(hsHeader("new"), claims(map[string]interface{}{"iss": "evil"}),
+            hs256("new secret")), "", 0, "invalid issuer"},
+        {signTestToken(hsHeader("new"), claims(map[string]interface{}{"aud": "other"}),
+            hs256("new secret")), "", 0, "invalid audience"},
+        {"not.a.token", "", 0, "malformed token header"},
+    }
+    for i, test := range tests {
+        r := basicAuthRequest("Bearer " + test.token)
+        user, roles := provider.GetUserAndRoles(r)
+        if user != test.user || len(roles) != test.roles {
+            t.Errorf("#%d got user %s roles %v", i, user, roles)
+        }
+        header := provider.AuthHeader(r)
+        if test.err == "" {
+            if strings.Contains(header, "error=") {
+                t.Errorf("#%d auth header is `%s`", i, header)
+            }
+        } else if header != `Bearer realm="api", error="invalid_token", error_description="`+test.err+`"` {
+            t.Errorf("#%d auth header is `%s`", i, header)
+        }
+    }
+
+    r := basicAuthRequest(basicAuth("alice", "bar"))
+    if user, _ := provider.GetUserAndRoles(r); user != "" {
+        t.Errorf("basic auth accepted as %s", user)
+    }
+    if provider.AuthHeader(r) != `Bearer realm="api"` {
+        t.Errorf("auth header is `%s`", provider.AuthHeader(r))
+    }
+}
+
+func TestBearerRequireExp(t *testing.T) {
+    provider := CreateBearerUserProvider("api")
+    provider.AddHMACKey("", []byte("secret"))
+    token := signTestToken(map[string]interface{}{"alg": "HS256"},
+        map[string]interface{}{"sub": "alice"}, hs256("secret"))
+    if _, err := provider.Verify(token); err != nil {
+        t.Errorf("token without exp is rejected: %s", err)
+    }
+    provider.RequireExp = true
+    if _, err := provider.Verify(token); err == nil || err.Error() != "token has no expiry" {
+        t.Errorf("token without exp gets error %v", err)
+    }
+
+    defer func() {
+        if recover() == nil {
+            t.Errorf("short Ed25519 key is added")
+        }
+    }()
+    provider.AddEd25519Key("short", ed25519.PublicKey("short"))
+}
+
+func TestBearerKeyRotation(t *testing.T) {
+    provider := CreateBearerUserProvider("api")
+    token := signTestToken(map[string]interface{}{"alg": "HS256"},
+        map[string]interface{}{"sub": "alice"}, hs256("secret"))
+    done := make(chan struct{})
+    go func() {
+        for i := 0; i < 100; i++ {
+            provider.AddHMACKey(strconv.Itoa(i), []byte("other"))
+        }
+        close(done)
+    }()
+    for i := 0; i < 100; i++ {
+        provider.Verify(token)
+    }
+    <-done
+}
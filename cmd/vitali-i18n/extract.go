@@ -0,0 +1,92 @@
+package main
+
+import (
+    "os"
+    "fmt"
+    "regexp"
+    "strings"
+    "strconv"
+    "io/ioutil"
+    "go/ast"
+    "go/token"
+    "go/parser"
+    "path/filepath"
+)
+
+var viewKeyRes = []*regexp.Regexp{
+    regexp.MustCompile(`\.S\.([A-Za-z_][A-Za-z0-9_]*)`),
+    regexp.MustCompile(`\.T\s+"([^"]+)"`),
+}
+
+// usedKeys finds the keys looked up by {{.S.KEY}} and {{.C.T "KEY"}} in the
+// views, and by T("KEY") calls on Ctx in the go sources, with the locations
+// they are used at.
+func usedKeys(views string, src string) (map[string][]string, error) {
+    used := make(map[string][]string)
+    add := func(key string, where string) {
+        used[key] = append(used[key], where)
+    }
+
+    err := filepath.Walk(views, func(path string, info os.FileInfo, err error) error {
+        if err != nil || info.IsDir() || strings.HasSuffix(path, ".json") {
+            return err
+        }
+        content, err := ioutil.ReadFile(path)
+        if err != nil {
+            return err
+        }
+        for i, line := range strings.Split(string(content), "\n") {
+            for _, re := range viewKeyRes {
+                for _, match := range re.FindAllStringSubmatch(line, -1) {
+                    add(match[1], fmt.Sprintf("%s:%d", path, i+1))
+                }
+            }
+        }
+        return nil
+    })
+    if err != nil {
+        return nil, err
+    }
+
+    fset := token.NewFileSet()
+    err = filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+        if err != nil {
+            return err
+        }
+        if info.IsDir() {
+            if path != src && strings.HasPrefix(info.Name(), ".") {
+                return filepath.SkipDir
+            }
+            return nil
+        }
+        if !strings.HasSuffix(path, ".go") || strings.HasSuffix(path, "_test.go") {
+            return nil
+        }
+        f, err := parser.ParseFile(fset, path, nil, 0)
+        if err != nil {
+            return err
+        }
+        ast.Inspect(f, func(n ast.Node) bool {
+            call, ok := n.(*ast.CallExpr)
+            if !ok || len(call.Args) == 0 {
+                return true
+            }
+            sel, ok := call.Fun.(*ast.SelectorExpr)
+            if !ok || sel.Sel.Name != "T" {
+                return true
+            }
+            lit, ok := call.Args[0].(*ast.BasicLit)
+            if !ok || lit.Kind != token.STRING {
+                return true
+            }
+            key, err := strconv.Unquote(lit.Value)
+            if err == nil {
+                pos := fset.Position(lit.Pos())
+                add(key, fmt.Sprintf("%s:%d", pos.Filename, pos.Line))
+            }
+            return true
+        })
+        return nil
+    })
+    return used, err
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+    "io"
+    "fmt"
+    "bufio"
+    "strings"
+    "strconv"
+    "encoding/csv"
+    "encoding/xml"
+)
+
+// only the newlines and tabs are escaped, like the TSV files of the old
+// python scripts, whose backslashes are kept as they are
+var (
+    tsvEscaper = strings.NewReplacer("\n", "\\n", "\t", "\\t")
+    tsvUnescaper = strings.NewReplacer("\\n", "\n", "\\t", "\t")
+)
+
+// writeTable writes one row per key and one column per language, with the
+// empty cells for the missing translations.
+func writeTable(w io.Writer, dict dictionary, langs []string, sep rune) error {
+    rows := [][]string{append([]string{""}, langs...)}
+    for _, key := range dict.keys() {
+        row := []string{key}
+        for _, lang := range langs {
+            row = append(row, string(dict[lang][key]))
+        }
+        rows = append(rows, row)
+    }
+
+    if sep == ',' {
+        cw := csv.NewWriter(w)
+        cw.WriteAll(rows)
+        return cw.Error()
+    }
+    bw := bufio.NewWriter(w)
+    for _, row := range rows {
+        for i, cell := range row {
+            if i > 0 {
+                bw.WriteString("\t")
+            }
+            bw.WriteString(tsvEscaper.Replace(cell))
+        }
+        bw.WriteString("\n")
+    }
+    return bw.Flush()
+}
+
+func readTable(r io.Reader, dict dictionary, sep rune) error {
+    var rows [][]string
+    if sep == ',' {
+        var err error
+        rows, err = csv.NewReader(r).ReadAll()
+        if err != nil {
+            return err
+        }
+    } else {
+        scanner := bufio.NewScanner(r)
+        scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+        for scanner.Scan() {
+            line := strings.TrimRight(scanner.Text(), "\r")
+            if line == "" {
+                continue
+            }
+            cells := strings.Split(line, "\t")
+            for i := range cells {
+                cells[i] = tsvUnescaper.Replace(cells[i])
+            }
+            rows = append(rows, cells)
+        }
+        if err := scanner.Err(); err != nil {
+            return err
+        }
+    }
+
+    if len(rows) == 0 {
+        return fmt.Errorf("empty table")
+    }
+    header := rows[0]
+    for _, row := range rows[1:] {
+        for i := 1; i < len(row) && i < len(header); i++ {
+            dict.set(header[i], row[0], row[i])
+        }
+    }
+    return nil
+}
+
+type xliff struct {
+    XMLName xml.Name `xml:"urn:oasis:names:tc:xliff:document:1.2 xliff"`
+    Version string `xml:"version,attr"`
+    Files []xliffFile `xml:"file"`
+}
+
+type xliffFile struct {
+    Original string `xml:"original,attr"`
+    SourceLanguage string `xml:"source-language,attr"`
+    TargetLanguage string `xml:"target-language,attr,omitempty"`
+    Datatype string `xml:"datatype,attr"`
+    Units []xliffUnit `xml:"body>trans-unit"`
+}
+
+type xliffUnit struct {
+    ID string `xml:"id,attr"`
+    Source string `xml:"source"`
+    Target string `xml:"target,omitempty"`
+}
+
+// writeXliff writes an XLIFF 1.2 document with one file element per target
+// language.
+func writeXliff(w io.Writer, dict dictionary, source string, langs []string) error {
+    doc := xliff{Version: "1.2"}
+    for _, lang := range langs {
+        if lang == source {
+            continue
+        }
+        file := xliffFile{
+            Original: "i18n.json",
+            SourceLanguage: source,
+            TargetLanguage: lang,
+            Datatype: "html",
+        }
+        for _, key := range dict.keys() {
+            file.Units = append(file.Units, xliffUnit{
+                ID: key,
+                Source: string(dict[source][key]),
+                Target: string(dict[lang][key]),
+            })
+        }
+        doc.Files = append(doc.Files, file)
+    }
+
+    io.WriteString(w, xml.Header)
+    enc := xml.NewEncoder(w)
+    enc.Indent("", "  ")
+    err := enc.Encode(doc)
+    io.WriteString(w, "\n")
+    return err
+}
+
+func readXliff(r io.Reader, dict dictionary) error {
+    var doc xliff
+    err := xml.NewDecoder(r).Decode(&doc)
+    if err != nil {
+        return err
+    }
+    for _, file := range doc.Files {
+        for _, unit := range file.Units {
+            dict.set(file.SourceLanguage, unit.ID, unit.Source)
+            if file.TargetLanguage != "" {
+                dict.set(file.TargetLanguage, unit.ID, unit.Target)
+            }
+        }
+    }
+    return nil
+}
+
+func poQuote(s string) string {
+    s = strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\t", "\\t").Replace(s)
+    if !strings.Contains(s, "\n") {
+        return `"` + s + `"`
+    }
+    lines := strings.SplitAfter(s, "\n")
+    quoted := []string{`""`}
+    for _, line := range lines {
+        if line != "" {
+            quoted = append(quoted, `"`+strings.Replace(line, "\n", `\n`, -1)+`"`)
+        }
+    }
+    return strings.Join(quoted, "\n")
+}
+
+// writePo writes a gettext PO file of lang which uses the keys as msgid,
+// with the source language text as an extracted comment.
+func writePo(w io.Writer, dict dictionary, source string, lang string) error {
+    bw := bufio.NewWriter(w)
+    fmt.Fprintf(bw, "msgid \"\"\nmsgstr \"\"\n\"Language: %s\\n\"\n", lang)
+    fmt.Fprintf(bw, "\"Content-Type: text/plain; charset=UTF-8\\n\"\n")
+    for _, key := range dict.keys() {
+        bw.WriteString("\n")
+        if src, ok := dict[source][key]; ok && source != lang {
+            for _, line := range strings.Split(string(src), "\n") {
+                fmt.Fprintf(bw, "#. %s\n", line)
+            }
+        }
+        fmt.Fprintf(bw, "msgid %s\nmsgstr %s\n", poQuote(key), poQuote(string(dict[lang][key])))
+    }
+    return bw.Flush()
+}
+
+func readPo(r io.Reader, dict dictionary, lang string) error {
+    var msgid, msgstr string
+    var current *string
+    entries := make(map[string]string)
+    flush := func() {
+        if current != nil {
+            entries[msgid] = msgstr
+        }
+        msgid, msgstr, current = "", "", nil
+    }
+
+    scanner := bufio.NewScanner(r)
+    scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+    for scanner.Scan() {
+        line := strings.TrimSpace(scanner.Text())
+        var value string
+        switch {
+        case line == "" || strings.HasPrefix(line, "#"):
+            continue
+        case strings.HasPrefix(line, "msgid "):
+            if current == &msgstr {
+                flush()
+            }
+            current = &msgid
+            value = strings.TrimPrefix(line, "msgid ")
+        case strings.HasPrefix(line, "msgstr "):
+            current = &msgstr
+            value = strings.TrimPrefix(line, "msgstr ")
+        case strings.HasPrefix(line, `"`) && current != nil:
+            value = line
+        default:
+            return fmt.Errorf("unexpected line: %s", line)
+        }
+        unquoted, err := strconv.Unquote(value)
+        if err != nil {
+            return fmt.Errorf("invalid string %s: %s", value, err)
+        }
+        *current += unquoted
+    }
+    flush()
+    if err := scanner.Err(); err != nil {
+        return err
+    }
+
+    if lang == "" {
+        for _, header := range strings.Split(entries[""], "\n") {
+            if strings.HasPrefix(header, "Language:") {
+                lang = strings.TrimSpace(strings.TrimPrefix(header, "Language:"))
+            }
+        }
+    }
+    if lang == "" {
+        return fmt.Errorf("unknown language, use -lang")
+    }
+    for key, msg := range entries {
+        if key != "" {
+            dict.set(lang, key, msg)
+        }
+    }
+    return nil
+}
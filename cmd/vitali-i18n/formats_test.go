@@ -0,0 +1,82 @@
+package main
+
+import (
+    "bytes"
+    "testing"
+    "reflect"
+)
+
+func testDictionary() dictionary {
+    dict := make(dictionary)
+    dict.set("en-us", "HI", "hi")
+    dict.set("en-us", "MULTI", "line 1\n\tline \"2\"")
+    dict.set("en-us", "ONLY_EN", "<b>only</b>, en")
+    dict.set("zh-tw", "HI", "嗨")
+    dict.set("zh-tw", "MULTI", "第一行\n第二行")
+    return dict
+}
+
+func TestRoundTrip(t *testing.T) {
+    dict := testDictionary()
+    formats := []struct {
+        name string
+        write func(*bytes.Buffer) error
+        read func(*bytes.Buffer, dictionary) error
+    }{
+        {"tsv", func(b *bytes.Buffer) error { return writeTable(b, dict, dict.langs(), '\t') },
+            func(b *bytes.Buffer, d dictionary) error { return readTable(b, d, '\t') }},
+        {"csv", func(b *bytes.Buffer) error { return writeTable(b, dict, dict.langs(), ',') },
+            func(b *bytes.Buffer, d dictionary) error { return readTable(b, d, ',') }},
+        {"xliff", func(b *bytes.Buffer) error { return writeXliff(b, dict, "en-us", dict.langs()) },
+            func(b *bytes.Buffer, d dictionary) error { return readXliff(b, d) }},
+    }
+    for _, format := range formats {
+        var b bytes.Buffer
+        if err := format.write(&b); err != nil {
+            t.Errorf("%s: write error %s", format.name, err)
+        }
+        imported := make(dictionary)
+        if err := format.read(&b, imported); err != nil {
+            t.Errorf("%s: read error %s", format.name, err)
+        }
+        if !reflect.DeepEqual(dict, imported) {
+            t.Errorf("%s: imported %v", format.name, imported)
+        }
+    }
+
+    var b bytes.Buffer
+    if err := writePo(&b, dict, "en-us", "zh-tw"); err != nil {
+        t.Errorf("po: write error %s", err)
+    }
+    imported := make(dictionary)
+    if err := readPo(&b, imported, ""); err != nil {
+        t.Errorf("po: read error %s", err)
+    }
+    if !reflect.DeepEqual(dict["zh-tw"], imported["zh-tw"]) || len(imported) != 1 {
+        t.Errorf("po: imported %v", imported)
+    }
+}
+
+func TestUsedKeys(t *testing.T) {
+    used, err := usedKeys("../../views", "../../views")
+    if err != nil {
+        t.Errorf("error %s", err)
+    }
+    if _, ok := used["HI"]; !ok {
+        t.Errorf("HI not found in %v", used)
+    }
+    if _, ok := used["GREETING"]; !ok {
+        t.Errorf("GREETING not found in %v", used)
+    }
+}
+
+func TestLegacyTsv(t *testing.T) {
+    b := bytes.NewBufferString("\ten-us\nSLASH\ta\\b or \\\\, line\\nbreak\n")
+    imported := make(dictionary)
+    if err := readTable(b, imported, '\t'); err != nil {
+        t.Errorf("read error %s", err)
+    }
+    if imported["en-us"]["SLASH"] != "a\\b or \\\\, line\nbreak" {
+        t.Errorf("imported `%s`", imported["en-us"]["SLASH"])
+    }
+}
@@ -0,0 +1,312 @@
+// Command vitali-i18n maintains the i18n dictionaries of a vitali webapp.
+//
+//   vitali-i18n export -format tsv|csv|xliff|po [-source en-us] [-lang zh-tw] views/i18n.json
+//   vitali-i18n import -format tsv|csv|xliff|po [-lang zh-tw] [-o views/i18n.json] file [views/i18n.json]
+//   vitali-i18n extract [-views views] [-src .]
+//   vitali-i18n check [-views views] [-src .] views/i18n.json
+//   vitali-i18n split [-o views/i18n] views/i18n.json
+//
+// The dictionary argument may be either an i18n.json file or a folder of per
+// language files created by split.
+package main
+
+import (
+    "os"
+    "fmt"
+    "flag"
+    "sort"
+    "strings"
+    "io/ioutil"
+    "encoding/json"
+    "path/filepath"
+    "html/template"
+    "github.com/lunastorm/vitali"
+)
+
+type dictionary map[string]map[string]template.HTML
+
+func main() {
+    if len(os.Args) < 2 {
+        usage()
+    }
+    var err error
+    switch os.Args[1] {
+    case "export":
+        err = export(os.Args[2:])
+    case "import":
+        err = importFile(os.Args[2:])
+    case "extract":
+        err = extract(os.Args[2:])
+    case "check":
+        err = check(os.Args[2:])
+    case "split":
+        err = split(os.Args[2:])
+    default:
+        usage()
+    }
+    if err != nil {
+        fmt.Fprintf(os.Stderr, "%s: %s\n", os.Args[1], err)
+        os.Exit(1)
+    }
+}
+
+func usage() {
+    fmt.Fprintf(os.Stderr, "Usage: %s export|import|extract|check|split [flags] [args]\n", os.Args[0])
+    os.Exit(2)
+}
+
+func loadDictionary(path string) (dictionary, error) {
+    dict := make(dictionary)
+    info, err := os.Stat(path)
+    if err != nil {
+        return nil, err
+    }
+
+    if !info.IsDir() {
+        content, err := ioutil.ReadFile(path)
+        if err != nil {
+            return nil, err
+        }
+        err = json.Unmarshal(content, &dict)
+        return dict, err
+    }
+
+    files, _ := filepath.Glob(filepath.Join(path, "*.json"))
+    for _, file := range files {
+        msgs := make(map[string]template.HTML)
+        content, err := ioutil.ReadFile(file)
+        if err == nil {
+            err = json.Unmarshal(content, &msgs)
+        }
+        if err != nil {
+            return nil, fmt.Errorf("%s: %s", file, err)
+        }
+        dict[strings.TrimSuffix(filepath.Base(file), ".json")] = msgs
+    }
+    return dict, nil
+}
+
+func writeJSON(path string, v interface{}) error {
+    out := os.Stdout
+    if path != "" && path != "-" {
+        f, err := os.Create(path)
+        if err != nil {
+            return err
+        }
+        defer f.Close()
+        out = f
+    }
+    enc := json.NewEncoder(out)
+    enc.SetEscapeHTML(false)
+    enc.SetIndent("", "    ")
+    return enc.Encode(v)
+}
+
+func (c dictionary) langs() []string {
+    langs := make([]string, 0, len(c))
+    for lang := range c {
+        langs = append(langs, lang)
+    }
+    sort.Strings(langs)
+    return langs
+}
+
+func (c dictionary) keys() []string {
+    seen := make(map[string]bool)
+    keys := make([]string, 0)
+    for _, msgs := range c {
+        for key := range msgs {
+            if !seen[key] {
+                seen[key] = true
+                keys = append(keys, key)
+            }
+        }
+    }
+    sort.Strings(keys)
+    return keys
+}
+
+func (c dictionary) set(lang string, key string, msg string) {
+    if msg == "" {
+        return
+    }
+    if c[lang] == nil {
+        c[lang] = make(map[string]template.HTML)
+    }
+    c[lang][key] = template.HTML(msg)
+}
+
+func export(args []string) error {
+    flags := flag.NewFlagSet("export", flag.ExitOnError)
+    format := flags.String("format", "tsv", "tsv, csv, xliff or po")
+    source := flags.String("source", "en-us", "source language of xliff and po")
+    lang := flags.String("lang", "", "only export this language")
+    flags.Parse(args)
+    if flags.NArg() != 1 {
+        return fmt.Errorf("missing dictionary")
+    }
+    dict, err := loadDictionary(flags.Arg(0))
+    if err != nil {
+        return err
+    }
+
+    langs := dict.langs()
+    if *lang != "" {
+        langs = []string{*lang}
+    }
+    switch *format {
+    case "tsv":
+        return writeTable(os.Stdout, dict, langs, '\t')
+    case "csv":
+        return writeTable(os.Stdout, dict, langs, ',')
+    case "xliff":
+        return writeXliff(os.Stdout, dict, *source, langs)
+    case "po":
+        if *lang == "" {
+            return fmt.Errorf("po needs -lang")
+        }
+        return writePo(os.Stdout, dict, *source, *lang)
+    }
+    return fmt.Errorf("unknown format %s", *format)
+}
+
+func importFile(args []string) error {
+    flags := flag.NewFlagSet("import", flag.ExitOnError)
+    format := flags.String("format", "tsv", "tsv, csv, xliff or po")
+    lang := flags.String("lang", "", "language of the po file if not in its header")
+    output := flags.String("o", "-", "output file")
+    flags.Parse(args)
+    if flags.NArg() < 1 {
+        return fmt.Errorf("missing input file")
+    }
+
+    dict := make(dictionary)
+    if flags.NArg() > 1 {
+        var err error
+        dict, err = loadDictionary(flags.Arg(1))
+        if err != nil {
+            return err
+        }
+    }
+    f, err := os.Open(flags.Arg(0))
+    if err != nil {
+        return err
+    }
+    defer f.Close()
+
+    switch *format {
+    case "tsv":
+        err = readTable(f, dict, '\t')
+    case "csv":
+        err = readTable(f, dict, ',')
+    case "xliff":
+        err = readXliff(f, dict)
+    case "po":
+        err = readPo(f, dict, *lang)
+    default:
+        err = fmt.Errorf("unknown format %s", *format)
+    }
+    if err != nil {
+        return err
+    }
+    return writeJSON(*output, dict)
+}
+
+func extract(args []string) error {
+    flags := flag.NewFlagSet("extract", flag.ExitOnError)
+    views := flags.String("views", "views", "views folder")
+    src := flags.String("src", ".", "go source folder")
+    flags.Parse(args)
+
+    used, err := usedKeys(*views, *src)
+    if err != nil {
+        return err
+    }
+    keys := make([]string, 0, len(used))
+    for key := range used {
+        keys = append(keys, key)
+    }
+    sort.Strings(keys)
+    for _, key := range keys {
+        fmt.Printf("%s\t%s\n", key, strings.Join(used[key], ","))
+    }
+    return nil
+}
+
+func check(args []string) error {
+    flags := flag.NewFlagSet("check", flag.ExitOnError)
+    views := flags.String("views", "views", "views folder")
+    src := flags.String("src", ".", "go source folder")
+    flags.Parse(args)
+    if flags.NArg() != 1 {
+        return fmt.Errorf("missing dictionary")
+    }
+    dict, err := loadDictionary(flags.Arg(0))
+    if err != nil {
+        return err
+    }
+    used, err := usedKeys(*views, *src)
+    if err != nil {
+        return err
+    }
+
+    problems := 0
+    missing := vitali.MissingTranslations(dict)
+    for _, lang := range dict.langs() {
+        for _, key := range missing[lang] {
+            fmt.Printf("untranslated\t%s\t%s\n", lang, key)
+            problems++
+        }
+    }
+    for _, key := range dict.keys() {
+        if _, ok := used[key]; !ok {
+            fmt.Printf("unused\t\t%s\n", key)
+            problems++
+        }
+    }
+    usedList := make([]string, 0, len(used))
+    for key := range used {
+        usedList = append(usedList, key)
+    }
+    sort.Strings(usedList)
+    for _, key := range usedList {
+        found := false
+        for _, msgs := range dict {
+            if _, ok := msgs[key]; ok {
+                found = true
+            }
+        }
+        if !found {
+            fmt.Printf("missing\t\t%s\t%s\n", key, strings.Join(used[key], ","))
+            problems++
+        }
+    }
+    if problems > 0 {
+        return fmt.Errorf("%d problems found", problems)
+    }
+    return nil
+}
+
+func split(args []string) error {
+    flags := flag.NewFlagSet("split", flag.ExitOnError)
+    output := flags.String("o", "views/i18n", "output folder")
+    flags.Parse(args)
+    if flags.NArg() != 1 {
+        return fmt.Errorf("missing dictionary")
+    }
+    dict, err := loadDictionary(flags.Arg(0))
+    if err != nil {
+        return err
+    }
+    err = os.MkdirAll(*output, 0755)
+    if err != nil {
+        return err
+    }
+    for lang, msgs := range dict {
+        err = writeJSON(filepath.Join(*output, lang+".json"), msgs)
+        if err != nil {
+            return err
+        }
+    }
+    return nil
+}
@@ -0,0 +1,114 @@
+package vitali
+
+import (
+    "net/http"
+    "html/template"
+    "crypto/subtle"
+)
+
+type CSRFMode int
+
+const (
+    // the token is kept in the session, which needs webapp.Sessions
+    CSRFSynchronizer CSRFMode = iota
+    // the token is kept in a cookie, and the request must send it back. The
+    // token is not bound to the session, so a subdomain or a man in the middle
+    // able to set the cookie can forge the requests.
+    CSRFDoubleSubmit
+)
+
+// CSRFGuard rejects the requests with a method other than GET, HEAD, OPTIONS
+// and TRACE unless they carry the CSRF token in the FieldName form field or
+// the HeaderName header. The forms get the token by {{.C.CSRFField}}, and the
+// scripts by {{.C.CSRFToken}} or the CookieName cookie in CSRFDoubleSubmit
+// mode. The resources with a vitali.CSRF `METHOD:"exempt"` tag are not
+// checked, like the APIs authenticated by tokens.
+type CSRFGuard struct {
+    Mode CSRFMode
+    FieldName string
+    HeaderName string
+    CookieName string
+    Secure bool
+}
+
+func CreateCSRFGuard(mode CSRFMode) *CSRFGuard {
+    return &CSRFGuard{
+        Mode: mode,
+        FieldName: "csrf_token",
+        HeaderName: "X-CSRF-Token",
+        CookieName: "vitali_csrf",
+    }
+}
+
+type CSRF struct{}
+
+const csrfSessionKey = "_csrf"
+
+func isSafeMethod(method string) bool {
+    return method == "GET" || method == "HEAD" || method == "OPTIONS" || method == "TRACE"
+}
+
+// CSRFToken returns the CSRF token of the client, which is created if there
+// is none yet. It returns "" if webapp.CSRF is not set.
+func (c *Ctx) CSRFToken() string {
+    if c.app == nil || c.app.CSRF == nil || c.session == nil {
+        return ""
+    }
+    if c.session.csrfToken != "" {
+        return c.session.csrfToken
+    }
+    guard := c.app.CSRF
+    token := guard.savedToken(c)
+    if token == "" {
+        token = newSessionID()
+        if guard.Mode == CSRFSynchronizer {
+            c.Session().Set(csrfSessionKey, token)
+        } else {
+            c.SetCookie(&http.Cookie{
+                Name: guard.CookieName,
+                Value: token,
+                Path: "/",
+                Secure: guard.Secure,
+                SameSite: http.SameSiteLaxMode,
+            })
+        }
+    }
+    c.session.csrfToken = token
+    return token
+}
+
+// CSRFField returns the hidden input of the CSRF token to be put in the forms.
+func (c *Ctx) CSRFField() template.HTML {
+    token := c.CSRFToken()
+    if token == "" {
+        return ""
+    }
+    return template.HTML(`<input type="hidden" name="` +
+        template.HTMLEscapeString(c.app.CSRF.FieldName) + `" value="` + token + `">`)
+}
+
+func (c *CSRFGuard) savedToken(ctx *Ctx) string {
+    if c.Mode == CSRFSynchronizer {
+        return ctx.Session().Get(csrfSessionKey)
+    }
+    return ctx.Cookie(c.CookieName)
+}
+
+// check returns why the request fails the CSRF check, or "" if it passes.
+func (c *CSRFGuard) check(ctx *Ctx) string {
+    saved := c.savedToken(ctx)
+    if saved == "" {
+        return "CSRF token missing"
+    }
+    sent := ctx.Request.Header.Get(c.HeaderName)
+    if sent == "" {
+        sent = ctx.Request.FormValue(c.FieldName)
+    }
+    if sent == "" {
+        return "CSRF token missing"
+    }
+    if subtle.ConstantTimeCompare([]byte(saved), []byte(sent)) != 1 {
+        return "CSRF token mismatch"
+    }
+    return ""
+}
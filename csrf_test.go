@@ -0,0 +1,137 @@
+package vitali
+
+import (
+    "strings"
+    "testing"
+    "net/http"
+    "net/url"
+    "net/http/httptest"
+)
+
+type CSRFTest struct {
+    Ctx
+}
+
+func (c *CSRFTest) Get() interface{} {
+    return string(c.CSRFField())
+}
+
+func (c *CSRFTest) Post() interface{} {
+    return "posted"
+}
+
+type CSRFExemptTest struct {
+    Ctx
+    CSRF `POST:"exempt"`
+}
+
+func (c *CSRFExemptTest) Post() interface{} {
+    return "posted"
+}
+
+type CSRFPermTest struct {
+    Ctx
+    Perm `POST:"_AUTHED"`
+}
+
+func (c *CSRFPermTest) Post() interface{} {
+    return "posted"
+}
+
+func csrfRequest(webapp webApp, method string, path string, form url.Values,
+        header http.Header, cookies []*http.Cookie) *httptest.ResponseRecorder {
+    if header == nil {
+        header = make(http.Header)
+    }
+    r := &http.Request{
+        Method: method,
+        URL: &url.URL{
+            Path: path,
+        },
+        Form: form,
+        Header: header,
+    }
+    for _, cookie := range cookies {
+        r.AddCookie(cookie)
+    }
+    rr := httptest.NewRecorder()
+    webapp.ServeHTTP(rr, r)
+    return rr
+}
+
+func TestCSRF(t *testing.T) {
+    for _, mode := range []CSRFMode{CSRFSynchronizer, CSRFDoubleSubmit} {
+        webapp := CreateWebApp([]RouteRule{
+            {"/csrf", CSRFTest{}},
+            {"/exempt", CSRFExemptTest{}},
+        })
+        webapp.Sessions = CreateSessionManager(CreateMemoryStore())
+        webapp.CSRF = CreateCSRFGuard(mode)
+
+        rr := csrfRequest(webapp, "GET", "/csrf", nil, nil, nil)
+        field := rr.Body.String()
+        if !strings.HasPrefix(field, `<input type="hidden" name="csrf_token" value="`) {
+            t.Fatalf("mode %d field is `%s`", mode, field)
+        }
+        token := strings.Split(field, `"`)[5]
+        cookies := rr.Result().Cookies()
+
+        tests := []struct {
+            path string
+            form url.Values
+            header http.Header
+            cookies []*http.Cookie
+            code int
+            body string
+        }{
+            {"/csrf", url.Values{"csrf_token": {token}}, nil, cookies, http.StatusOK, "posted"},
+            {"/csrf", nil, http.Header{"X-Csrf-Token": {token}}, cookies, http.StatusOK, "posted"},
+            {"/csrf", nil, nil, cookies, http.StatusForbidden, "Forbidden: CSRF token missing\n"},
+            {"/csrf", url.Values{"csrf_token": {"x" + token}}, nil, cookies, http.StatusForbidden,
+                "Forbidden: CSRF token mismatch\n"},
+            {"/csrf", url.Values{"csrf_token": {token}}, nil, nil, http.StatusForbidden,
+                "Forbidden: CSRF token missing\n"},
+            {"/exempt", nil, nil, nil, http.StatusOK, "posted"},
+        }
+        for i, test := range tests {
+            rr := csrfRequest(webapp, "POST", test.path, test.form, test.header, test.cookies)
+            if rr.Code != test.code || rr.Body.String() != test.body {
+                t.Errorf("mode %d #%d got %d `%s`", mode, i, rr.Code, rr.Body.String())
+            }
+        }
+    }
+}
+
+func TestCSRFWithoutSessions(t *testing.T) {
+    webapp := CreateWebApp([]RouteRule{
+        {"/csrf", CSRFTest{}},
+    })
+    webapp.CSRF = CreateCSRFGuard(CSRFSynchronizer)
+    if webapp.Validate() == nil {
+        t.Errorf("CSRFSynchronizer without Sessions is valid")
+    }
+    for _, method := range []string{"GET", "POST"} {
+        rr := csrfRequest(webapp, method, "/csrf", nil, nil, nil)
+        if rr.Code != http.StatusInternalServerError {
+            t.Errorf("%s response code is %d", method, rr.Code)
+        }
+    }
+}
+
+func TestCSRFAfterPerm(t *testing.T) {
+    webapp := CreateWebApp([]RouteRule{
+        {"/perm", CSRFPermTest{}},
+    })
+    webapp.Sessions = CreateSessionManager(CreateMemoryStore())
+    webapp.CSRF = CreateCSRFGuard(CSRFSynchronizer)
+
+    rr := csrfRequest(webapp, "POST", "/perm", nil, nil, nil)
+    if rr.Code != http.StatusUnauthorized {
+        t.Errorf("response code is %d", rr.Code)
+    }
+    webapp.UserProvider = Auther{}
+    rr = csrfRequest(webapp, "POST", "/perm", nil, nil, nil)
+    if rr.Code != http.StatusForbidden || !strings.Contains(rr.Body.String(), "CSRF token missing") {
+        t.Errorf("authed response is %d `%s`", rr.Code, rr.Body.String())
+    }
+}
@@ -6,14 +6,20 @@ import (
 
 type Ctx struct {
     Username    string
+    AuthScheme  string
     Roles       Roles
     Request *http.Request
     ResponseWriter  http.ResponseWriter
     ChosenType  MediaType
     ChosenLang  string
     ContentType MediaType
+    RequestID   string
 
     pathParams map[string]string
+    route string
+    app *webApp
+    pathLang string
+    session *sessionSlot
 }
 
 func (c *Ctx) AddHeader(key string, value string) {
@@ -0,0 +1,42 @@
+package vitali
+
+import (
+    "fmt"
+    "net/http"
+    "encoding/xml"
+    "encoding/json"
+)
+
+// DecodeError is returned by Decode when the request body is malformed.
+type DecodeError struct {
+    ContentType MediaType
+    Err error
+}
+
+func (c *DecodeError) Error() string {
+    return fmt.Sprintf("decode %s: %s", c.ContentType, c.Err)
+}
+
+func (c *DecodeError) Unwrap() error {
+    return c.Err
+}
+
+// Decode unmarshals the JSON or XML request body into v. The errors carry
+// 415 for the other content types and 400 for a malformed body, and go
+// through the ErrorMappers when returned by the handler.
+func (c *Ctx) Decode(v interface{}) error {
+    var err error
+    switch c.ContentType {
+    case "application/json":
+        err = json.NewDecoder(c.Request.Body).Decode(v)
+    case "application/xml", "text/xml":
+        err = xml.NewDecoder(c.Request.Body).Decode(v)
+    default:
+        return WithStatus(http.StatusUnsupportedMediaType,
+            fmt.Errorf("cannot decode %s", c.ContentType))
+    }
+    if err != nil {
+        return WithStatus(http.StatusBadRequest, &DecodeError{c.ContentType, err})
+    }
+    return nil
+}
@@ -0,0 +1,82 @@
+package vitali
+
+import (
+    "fmt"
+    "regexp"
+    "net/http"
+    "html/template"
+)
+
+// ErrorDetails is the .E of the error pages.
+type ErrorDetails struct {
+    Status int
+    Title string
+    Reason string
+    Code uint32
+    RequestID string
+}
+
+var errorPageKey = regexp.MustCompile("^[1-5]([0-9][0-9]|xx)$")
+
+// ErrorPage registers the templates rendered for the error responses without
+// a body, like the views, when text/html is negotiated. The status is a code
+// like "404", or a class like "4xx" for the codes not registered themselves.
+func (c *webApp) ErrorPage(status string, templatesName string) {
+    if !errorPageKey.MatchString(status) {
+        panic(fmt.Sprintf("invalid error page status %s", status))
+    }
+    updateTemplate(templatesName, c.views, c.funcMap, c.logger())
+    c.viewVariants[templatesName] = findViewVariants(templatesName, c.I18n)
+    for _, variant := range c.viewVariants[templatesName] {
+        updateTemplate(variant, c.views, c.funcMap, c.logger())
+    }
+    c.errorPages[status] = templatesName
+}
+
+// findErrorPage returns the templates registered for the status code or its
+// class, or "".
+func (c *webApp) findErrorPage(code int) string {
+    if page, ok := c.errorPages[fmt.Sprintf("%d", code)]; ok {
+        return page
+    }
+    return c.errorPages[fmt.Sprintf("%dxx", code/100)]
+}
+
+// acceptsHTML tells if text/html is negotiated for the error page. When the
+// resource chose no type, like the errors from routing, the Accept header
+// must prefer text/html to text/plain.
+func acceptsHTML(r *http.Request, ctx *Ctx) bool {
+    if ctx.ChosenType != "" {
+        return ctx.ChosenType == "text/html"
+    }
+    return chooseType(MediaTypes{"text/plain", "text/html"}, r.Header.Get("Accept")) == "text/html"
+}
+
+// httpError writes the error page registered for the status, or msg as plain
+// text like http.Error.
+func (c *webApp) httpError(w *wrappedWriter, r *http.Request, ctx *Ctx, msg string, details ErrorDetails) {
+    page := c.findErrorPage(details.Status)
+    if page == "" || !acceptsHTML(r, ctx) {
+        http.Error(w, msg, details.Status)
+        return
+    }
+    details.RequestID = w.requestID
+    if details.Title == "" {
+        details.Title = http.StatusText(details.Status)
+    }
+
+    m := struct{
+        S map[string]template.HTML
+        C *Ctx
+        W *webApp
+        E ErrorDetails
+    }{
+        c.labels(ctx),
+        ctx,
+        c,
+        details,
+    }
+    w.Header().Set("Content-Type", "text/html")
+    w.WriteHeader(details.Status)
+    c.executeView(w, c.chooseView(page, ctx.ChosenLang), m)
+}
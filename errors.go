@@ -0,0 +1,150 @@
+package vitali
+
+import (
+    "errors"
+    "reflect"
+    "net/http"
+)
+
+// StatusError is implemented by the errors which carry the HTTP status of
+// the response, when they are returned by the handlers.
+type StatusError interface {
+    error
+    HTTPStatus() int
+}
+
+type statusError struct {
+    code int
+    err error
+}
+
+func (c statusError) Error() string {
+    return c.err.Error()
+}
+
+func (c statusError) Unwrap() error {
+    return c.err
+}
+
+func (c statusError) HTTPStatus() int {
+    return c.code
+}
+
+// WithStatus returns err carrying the HTTP status code, e.g.
+// WithStatus(http.StatusNotFound, err).
+func WithStatus(code int, err error) error {
+    return statusError{code, err}
+}
+
+// ErrorMapper returns the response of an error, like ctx.NotFound(), or nil
+// if the error is not mapped by it.
+type ErrorMapper func(ctx *Ctx, err error) interface{}
+
+// ErrorIs maps the errors matching target by errors.Is to the response of
+// the status code without a body.
+func ErrorIs(target error, code int) ErrorMapper {
+    return func(ctx *Ctx, err error) interface{} {
+        if errors.Is(err, target) {
+            return statusResponse(code, err)
+        }
+        return nil
+    }
+}
+
+// ErrorAs maps the errors matching the type of target by errors.As to the
+// response of the status code without a body, e.g.
+// ErrorAs((*ValidationError)(nil), http.StatusUnprocessableEntity).
+func ErrorAs(target error, code int) ErrorMapper {
+    tTarget := reflect.TypeOf(target)
+    if tTarget == nil {
+        panic("ErrorAs target is a nil interface")
+    }
+    return func(ctx *Ctx, err error) interface{} {
+        if errors.As(err, reflect.New(tTarget).Interface()) {
+            return statusResponse(code, err)
+        }
+        return nil
+    }
+}
+
+// mapError returns the response of the first mapper of the webapp mapping
+// err, or of the status carried by err, or nil. A 401 without challenges is
+// given the ones of the UserProvider.
+func (c webApp) mapError(ctx *Ctx, err error) interface{} {
+    response := c.findMapping(ctx, err)
+    if v, ok := response.(unauthorized); ok && v.wwwAuthHeaders == nil &&
+            c.UserProvider != nil && ctx.Request != nil {
+        v.wwwAuthHeaders = authHeaders(c.UserProvider, ctx.Request)
+        response = v
+    }
+    return response
+}
+
+func (c webApp) findMapping(ctx *Ctx, err error) interface{} {
+    for _, mapper := range c.ErrorMappers {
+        if response := mapper(ctx, err); response != nil {
+            return response
+        }
+    }
+    var se StatusError
+    if errors.As(err, &se) {
+        return statusResponse(se.HTTPStatus(), err)
+    }
+    return nil
+}
+
+// errorResponse returns the response of an error returned by Pre or the
+// handlers. The errors not mapped are internal errors.
+func (c webApp) errorResponse(ctx *Ctx, err error) interface{} {
+    if response := c.mapError(ctx, err); response != nil {
+        return response
+    }
+    return internalError{
+        why: err.Error(),
+        code: errorCode(err.Error()),
+        err: err,
+    }
+}
+
+// statusResponse returns the response type of the status code, without a
+// body. The message of err is only given as the reason of 400 and 403.
+func statusResponse(code int, err error) interface{} {
+    switch code {
+    case http.StatusBadRequest:
+        return badRequest{reason: err.Error()}
+    case http.StatusUnauthorized:
+        return unauthorized{}
+    case http.StatusForbidden:
+        return forbidden{reason: err.Error()}
+    case http.StatusNotFound:
+        return notFound{}
+    case http.StatusConflict:
+        return conflict{}
+    case http.StatusGone:
+        return gone{}
+    case http.StatusPreconditionFailed:
+        return preconditionFailed{}
+    case http.StatusRequestEntityTooLarge:
+        return requestEntityTooLarge{}
+    case http.StatusUnsupportedMediaType:
+        return unsupportedMediaType{}
+    case http.StatusUnprocessableEntity:
+        return unprocessableEntity{}
+    case http.StatusTooManyRequests:
+        return tooManyRequests{seconds: -1}
+    case http.StatusInternalServerError:
+        return internalError{
+            why: err.Error(),
+            code: errorCode(err.Error()),
+        }
+    case http.StatusNotImplemented:
+        return notImplemented{}
+    case http.StatusBadGateway:
+        return badGateway{}
+    case http.StatusServiceUnavailable:
+        return serviceUnavailable{seconds: -1}
+    case http.StatusGatewayTimeout:
+        return gatewayTimeout{}
+    }
+    return status{code: code}
+}
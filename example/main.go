@@ -3,7 +3,6 @@ package main
 import (
     "log"
     "net/http"
-    "html/template"
     "github.com/lunastorm/vitali"
     "github.com/lunastorm/vitali/example/util"
     "github.com/lunastorm/vitali/example/resources"
@@ -11,7 +10,16 @@ import (
 
 func main() {
     http.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir("./static"))))
+    userProvider, err := vitali.CreateHtpasswdUserProvider("vitali", "htpasswd", "htgroup")
+    if err != nil {
+        log.Fatalf("failed to load htpasswd: %s", err)
+    }
     webapp := vitali.CreateWebApp([]vitali.RouteRule{
+        {"/login", vitali.Login{
+            Checker: userProvider,
+        }},
+        {"/logout", vitali.Logout{
+        }},
         {"/image", resources.Images{
         }},
         {"/image/{filename}", resources.Image{
@@ -24,11 +32,16 @@ func main() {
         {"/user/{user}/slide/{name}/{page}", resources.Slide{
         }},
     })
-    webapp.UserProvider = &util.UserProvider{}
-    webapp.LangProvider = &util.LangProvider{webapp.I18n}
-    webapp.Settings["401_PAGE"] = "/login"
-    webapp.ErrTemplate = template.Must(template.ParseFiles("views/base.html",
-        "views/error.html"))
+    webapp.Sessions = vitali.CreateSessionManager(vitali.CreateCookieStore("vitali example secret"))
+    webapp.CSRF = vitali.CreateCSRFGuard(vitali.CSRFDoubleSubmit)
+    webapp.MethodOverride = []string{"PUT", "DELETE"}
+    webapp.UserProvider = vitali.CreateChainedUserProvider(
+        &vitali.SessionUserProvider{Sessions: webapp.Sessions}, userProvider)
+    langProvider := vitali.CreateStandardLangProvider(webapp.I18n)
+    langProvider.Default = "en-us"
+    webapp.LangProvider = langProvider
+    webapp.Settings["LOGIN_URL"] = "/login"
+    webapp.ErrorPage("5xx", "base.html,error.html")
     http.Handle("/", webapp)
     log.Printf("starting server at port 8080...")
     http.ListenAndServe(":8080", nil)
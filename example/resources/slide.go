@@ -24,7 +24,7 @@ func (c *SlideModel) RemovePage(idx int) {
 
 type Slide struct {
     vitali.Ctx
-    vitali.Perm `GET:"AUTHED" *:"OWNER"`
+    vitali.Perm `GET:"AUTHED" *:"policy:ownerOf(user)"`
     vitali.Provides `GET:"application/json,text/html"`
     vitali.Views `GET:"base.html,slide.html"`
     Page uint64
@@ -49,10 +49,6 @@ func (c *Slide) Pre() interface{} {
     if err != nil {
         return c.NotFound()
     }
-
-    if c.PathParam("user") == c.Username {
-        c.Roles.Add("OWNER")
-    }
     return nil
 }
 
@@ -104,22 +100,27 @@ func (c *Slide) saveSlide(s *SlideModel) {
 
 func (c *Slide) Post() interface{} {
     slide := c.getSlide()
-    if c.Param("create") == "create" || c.Param("create") == "dup" {
-        if c.Param("create") == "create" {
-            slide.InsertPage(int(c.Page), "", "")
-        } else {
-            slide.InsertPage(int(c.Page), slide.Pages[int(c.Page-1)].Raw,
-                slide.Pages[int(c.Page-1)].CSS)
-        }
-        c.saveSlide(&slide)
-        c.SetCookie(&http.Cookie{
-            Name: "create",
-            Value: "create",
-            Path: fmt.Sprintf("/user/%s/slide/%s/%d", c.PathParam("user"), c.PathParam("name"), c.Page+1),
-            Expires: time.Now().Add(30*24*time.Hour),
-        })
-        return c.SeeOther(fmt.Sprintf("%d", c.Page+1))
+    switch c.Param("create") {
+    case "create":
+        slide.InsertPage(int(c.Page), "", "")
+    case "dup":
+        slide.InsertPage(int(c.Page), slide.Pages[int(c.Page-1)].Raw,
+            slide.Pages[int(c.Page-1)].CSS)
+    default:
+        return c.BadRequest("create should be create or dup")
     }
+    c.saveSlide(&slide)
+    c.SetCookie(&http.Cookie{
+        Name: "create",
+        Value: "create",
+        Path: fmt.Sprintf("/user/%s/slide/%s/%d", c.PathParam("user"), c.PathParam("name"), c.Page+1),
+        Expires: time.Now().Add(30*24*time.Hour),
+    })
+    return c.SeeOther(fmt.Sprintf("%d", c.Page+1))
+}
+
+func (c *Slide) Put() interface{} {
+    slide := c.getSlide()
     slide.Pages[c.Page-1].Raw = c.Param("raw")
     slide.Pages[c.Page-1].CSS = c.Param("css")
     c.saveSlide(&slide)
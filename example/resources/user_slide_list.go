@@ -9,18 +9,11 @@ import (
 
 type UserSlideList struct {
     vitali.Ctx
-    vitali.Perm `POST:"OWNER" DELETE:"OWNER"`
+    vitali.Perm `POST:"policy:ownerOf(user)" DELETE:"policy:ownerOf(user)"`
     vitali.Provides `GET:"application/json,text/html"`
     vitali.Views `GET:"base.html,user_slide_list.html"`
 }
 
-func (c *UserSlideList) Pre() interface{} {
-    if c.PathParam("user") == c.Username {
-        c.Roles.Add("OWNER")
-    }
-    return nil
-}
-
 func (c *UserSlideList) Get() interface{} {
     dir, err := os.Open("files/" + c.PathParam("user"))
     if err != nil {panic(err)}
@@ -1,3 +1,5 @@
+$.ajaxSetup({headers: {"X-CSRF-Token": $.cookie("vitali_csrf")}})
+
 function recenter(){
     $("#slide_wrapper").css("padding-left", (($(window).width()-1024)/2)+"px")
     $("#slide_wrapper").css("padding-right", (($(window).width()-1024)/2)+"px")
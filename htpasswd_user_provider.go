@@ -0,0 +1,308 @@
+package vitali
+
+import (
+    "sync"
+    "bufio"
+    "bytes"
+    "strings"
+    "net/http"
+    "io/ioutil"
+    "crypto/md5"
+    "crypto/sha1"
+    "crypto/subtle"
+    "path/filepath"
+    "encoding/base64"
+    "golang.org/x/crypto/bcrypt"
+    "github.com/go-fsnotify/fsnotify"
+)
+
+// compared against when the user does not exist, so that unknown users take
+// as long as the known ones
+const dummyBcryptHash = "$2a$10$n2.uCEcNpxp5kUltxsnZv.0qRIKKVAvUBKjVyg/g8BDrgIpIZ26fC"
+
+// HtpasswdUserProvider authenticates HTTP Basic credentials against an
+// htpasswd file with bcrypt, SHA or apr1 hashed passwords. The roles of a user
+// are the groups containing the user in the optional group file, which has
+// lines like
+//   ADMIN: alice bob
+// Both files are reloaded when they are changed, until Close is called.
+type HtpasswdUserProvider struct {
+    Realm string
+    PasswdFile string
+    GroupFile string
+
+    lock sync.RWMutex
+    passwords map[string]string
+    roles map[string][]string
+    logger *sharedLogger
+    watcher *fsnotify.Watcher
+}
+
+func CreateHtpasswdUserProvider(realm string, passwdFile string, groupFile string) (*HtpasswdUserProvider, error) {
+    c := &HtpasswdUserProvider{
+        Realm: realm,
+        PasswdFile: passwdFile,
+        GroupFile: groupFile,
+        logger: newSharedLogger(DefaultLogger),
+    }
+    err := c.Reload()
+    if err != nil {
+        return nil, err
+    }
+    err = c.watch()
+    if err != nil {
+        return nil, err
+    }
+    return c, nil
+}
+
+// Reload reads the htpasswd and group files again.
+func (c *HtpasswdUserProvider) Reload() error {
+    content, err := ioutil.ReadFile(c.PasswdFile)
+    if err != nil {
+        return err
+    }
+    passwords := make(map[string]string)
+    for _, line := range splitLines(content) {
+        parts := strings.SplitN(line, ":", 2)
+        if len(parts) == 2 {
+            passwords[parts[0]] = parts[1]
+        }
+    }
+
+    roles := make(map[string][]string)
+    if c.GroupFile != "" {
+        content, err = ioutil.ReadFile(c.GroupFile)
+        if err != nil {
+            return err
+        }
+        for _, line := range splitLines(content) {
+            parts := strings.SplitN(line, ":", 2)
+            if len(parts) != 2 {
+                continue
+            }
+            group := strings.TrimSpace(parts[0])
+            for _, user := range strings.Fields(parts[1]) {
+                roles[user] = append(roles[user], group)
+            }
+        }
+    }
+
+    c.lock.Lock()
+    defer c.lock.Unlock()
+    c.passwords = passwords
+    c.roles = roles
+    return nil
+}
+
+func splitLines(content []byte) (lines []string) {
+    scanner := bufio.NewScanner(bytes.NewReader(content))
+    for scanner.Scan() {
+        line := strings.TrimSpace(scanner.Text())
+        if line != "" && !strings.HasPrefix(line, "#") {
+            lines = append(lines, line)
+        }
+    }
+    return
+}
+
+func (c *HtpasswdUserProvider) watch() error {
+    watcher, err := fsnotify.NewWatcher()
+    if err != nil {
+        return err
+    }
+    files := map[string]bool{filepath.Clean(c.PasswdFile): true}
+    dirs := map[string]bool{filepath.Dir(c.PasswdFile): true}
+    if c.GroupFile != "" {
+        files[filepath.Clean(c.GroupFile)] = true
+        dirs[filepath.Dir(c.GroupFile)] = true
+    }
+    // watch the folders, as the files may be replaced rather than written
+    for dir := range dirs {
+        err = watcher.Add(dir)
+        if err != nil {
+            watcher.Close()
+            return err
+        }
+    }
+
+    c.lock.Lock()
+    c.watcher = watcher
+    c.lock.Unlock()
+
+    go func() {
+        for {
+            select {
+            case ev, ok := <-watcher.Events:
+                if !ok {
+                    return
+                }
+                if !files[filepath.Clean(ev.Name)] || ev.Op & fsnotify.Chmod == fsnotify.Chmod {
+                    break
+                }
+                err := c.Reload()
+                if err != nil {
+                    c.logger.Log(LevelError, "failed to reload htpasswd", "file", ev.Name,
+                        "error", err)
+                }
+            case err, ok := <-watcher.Errors:
+                if !ok {
+                    return
+                }
+                c.logger.Log(LevelError, "htpasswd watcher error", "error", err)
+            }
+        }
+    }()
+    return nil
+}
+
+// Close stops watching the files, which are not reloaded afterwards.
+func (c *HtpasswdUserProvider) Close() error {
+    c.lock.Lock()
+    watcher := c.watcher
+    c.watcher = nil
+    c.lock.Unlock()
+    if watcher == nil {
+        return nil
+    }
+    return watcher.Close()
+}
+
+func (c *HtpasswdUserProvider) AuthHeader(r *http.Request) string {
+    return `Basic realm="` + quoteParam(c.Realm) + `", charset="UTF-8"`
+}
+
+func (c *HtpasswdUserProvider) AuthScheme() string {
+    return "Basic"
+}
+
+func (c *HtpasswdUserProvider) GetUserAndRoles(r *http.Request) (string, []string) {
+    user, password, ok := parseBasicAuth(r.Header.Get("Authorization"))
+    if !ok {
+        return "", []string{}
+    }
+    roles, ok := c.CheckCredentials(user, password)
+    if !ok {
+        return "", []string{}
+    }
+    return user, roles
+}
+
+// CheckCredentials verifies the password of user, and returns the roles of
+// the user if it is correct.
+func (c *HtpasswdUserProvider) CheckCredentials(user string, password string) ([]string, bool) {
+    c.lock.RLock()
+    hash, exists := c.passwords[user]
+    roles := c.roles[user]
+    c.lock.RUnlock()
+    if !exists {
+        checkPassword(dummyBcryptHash, password)
+        return nil, false
+    }
+    if !checkPassword(hash, password) {
+        return nil, false
+    }
+    return append([]string{}, roles...), true
+}
+
+func parseBasicAuth(authHeader string) (user string, password string, ok bool) {
+    parts := strings.SplitN(authHeader, " ", 2)
+    if len(parts) != 2 || !strings.EqualFold(parts[0], "Basic") {
+        return
+    }
+    data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(parts[1]))
+    if err != nil {
+        return
+    }
+    credentials := strings.SplitN(string(data), ":", 2)
+    if len(credentials) != 2 || credentials[0] == "" {
+        return
+    }
+    return credentials[0], credentials[1], true
+}
+
+func checkPassword(hash string, password string) bool {
+    var expected, actual []byte
+    switch {
+    case strings.HasPrefix(hash, "$2"):
+        return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+    case strings.HasPrefix(hash, "{SHA}"):
+        sum := sha1.Sum([]byte(password))
+        expected = []byte(hash[len("{SHA}"):])
+        actual = []byte(base64.StdEncoding.EncodeToString(sum[:]))
+    case strings.HasPrefix(hash, "$apr1$"):
+        parts := strings.SplitN(hash[len("$apr1$"):], "$", 2)
+        if len(parts) != 2 {
+            return false
+        }
+        expected = []byte(hash)
+        actual = []byte(apr1Hash(password, parts[0]))
+    default:
+        // crypt and plain text passwords are not supported
+        return false
+    }
+    return subtle.ConstantTimeCompare(expected, actual) == 1
+}
+
+// apr1Hash is the Apache variant of the MD5 based crypt.
+func apr1Hash(password string, salt string) string {
+    const magic = "$apr1$"
+    const itoa64 = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+    if len(salt) > 8 {
+        salt = salt[:8]
+    }
+    pw := []byte(password)
+
+    alt := md5.Sum([]byte(password + salt + password))
+    h := md5.New()
+    h.Write([]byte(password + magic + salt))
+    for i := len(pw); i > 0; i -= 16 {
+        if i > 16 {
+            h.Write(alt[:])
+        } else {
+            h.Write(alt[:i])
+        }
+    }
+    for i := len(pw); i > 0; i >>= 1 {
+        if i & 1 == 1 {
+            h.Write([]byte{0})
+        } else {
+            h.Write(pw[:1])
+        }
+    }
+    final := h.Sum(nil)
+
+    for i := 0; i < 1000; i++ {
+        h := md5.New()
+        if i & 1 == 1 {
+            h.Write(pw)
+        } else {
+            h.Write(final)
+        }
+        if i % 3 != 0 {
+            h.Write([]byte(salt))
+        }
+        if i % 7 != 0 {
+            h.Write(pw)
+        }
+        if i & 1 == 1 {
+            h.Write(final)
+        } else {
+            h.Write(pw)
+        }
+        final = h.Sum(nil)
+    }
+
+    out := []byte(magic + salt + "$")
+    to64 := func(v uint32, n int) {
+        for ; n > 0; n-- {
+            out = append(out, itoa64[v & 0x3f])
+            v >>= 6
+        }
+    }
+    for _, idx := range [][3]int{{0, 6, 12}, {1, 7, 13}, {2, 8, 14}, {3, 9, 15}, {4, 10, 5}} {
+        to64(uint32(final[idx[0]]) << 16 | uint32(final[idx[1]]) << 8 | uint32(final[idx[2]]), 4)
+    }
+    to64(uint32(final[11]), 2)
+    return string(out)
+}
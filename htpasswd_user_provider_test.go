@@ -0,0 +1,105 @@
+package vitali
+
+import (
+    "os"
+    "time"
+    "testing"
+    "net/http"
+    "io/ioutil"
+    "path/filepath"
+    "encoding/base64"
+)
+
+// the password of every user is "bar"
+const testHtpasswd = `# comment
+alice:$apr1$Xr7g5fCz$UCO2GeIKCIB1hkwpshOY21
+bob:{SHA}Ys23Ag/5IOWqZCw9QGaVDdHwH00=
+carol:$2a$10$mN1ySUwLtTiChbb6g9kAgeqYXk0hzygGboUojvypycIDF/raYesbK
+dave:bar
+`
+
+const testHtgroup = `ADMIN: alice
+AUTHED: alice bob carol
+`
+
+func basicAuthRequest(authHeader string) *http.Request {
+    r := &http.Request{
+        Header: make(http.Header),
+    }
+    if authHeader != "" {
+        r.Header.Set("Authorization", authHeader)
+    }
+    return r
+}
+
+func basicAuth(user string, password string) string {
+    return "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+password))
+}
+
+func TestHtpasswdUserProvider(t *testing.T) {
+    dir, _ := ioutil.TempDir("", "vitali-htpasswd-")
+    defer os.RemoveAll(dir)
+    passwdFile := filepath.Join(dir, "htpasswd")
+    groupFile := filepath.Join(dir, "htgroup")
+    ioutil.WriteFile(passwdFile, []byte(testHtpasswd), 0600)
+    ioutil.WriteFile(groupFile, []byte(testHtgroup), 0600)
+
+    provider, err := CreateHtpasswdUserProvider(`my "realm"`, passwdFile, groupFile)
+    if err != nil {
+        t.Fatalf("create error %s", err)
+    }
+    if provider.AuthHeader(nil) != `Basic realm="my \"realm\"", charset="UTF-8"` {
+        t.Errorf("auth header is `%s`", provider.AuthHeader(nil))
+    }
+
+    tests := []struct {
+        authHeader string
+        user string
+        roles int
+    }{
+        {basicAuth("alice", "bar"), "alice", 2},
+        {basicAuth("bob", "bar"), "bob", 1},
+        {basicAuth("carol", "bar"), "carol", 1},
+        {basicAuth("alice", "baz"), "", 0},
+        {basicAuth("dave", "bar"), "", 0},
+        {basicAuth("eve", "bar"), "", 0},
+        {"Basic " + base64.StdEncoding.EncodeToString([]byte("alice")), "", 0},
+        {"Basic !!!", "", 0},
+        {"Basic", "", 0},
+        {"Bearer foo", "", 0},
+        {"", "", 0},
+    }
+    for _, test := range tests {
+        user, roles := provider.GetUserAndRoles(basicAuthRequest(test.authHeader))
+        if user != test.user || len(roles) != test.roles {
+            t.Errorf("%s: user is `%s`, roles are %v", test.authHeader, user, roles)
+        }
+    }
+
+    ioutil.WriteFile(passwdFile, []byte("erin:{SHA}Ys23Ag/5IOWqZCw9QGaVDdHwH00=\n"), 0600)
+    var user string
+    for i := 0; i < 100 && user == ""; i++ {
+        time.Sleep(20 * time.Millisecond)
+        user, _ = provider.GetUserAndRoles(basicAuthRequest(basicAuth("erin", "bar")))
+    }
+    if user != "erin" {
+        t.Errorf("htpasswd is not reloaded")
+    }
+    user, _ = provider.GetUserAndRoles(basicAuthRequest(basicAuth("alice", "bar")))
+    if user != "" {
+        t.Errorf("removed user is `%s`", user)
+    }
+
+    if err := provider.Close(); err != nil {
+        t.Errorf("close error %s", err)
+    }
+    ioutil.WriteFile(passwdFile, []byte(testHtpasswd), 0600)
+    time.Sleep(200 * time.Millisecond)
+    user, _ = provider.GetUserAndRoles(basicAuthRequest(basicAuth("alice", "bar")))
+    if user != "" {
+        t.Errorf("htpasswd is reloaded after close")
+    }
+    if err := provider.Close(); err != nil {
+        t.Errorf("second close error %s", err)
+    }
+}
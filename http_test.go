@@ -1,6 +1,9 @@
 package vitali
 
 import (
+    "fmt"
+    "errors"
+    "strings"
     "testing"
     "net/http"
     "net/url"
@@ -188,9 +191,17 @@ func TestMethodNotAllowed(t *testing.T) {
         t.Errorf("response code is %d", rr.Code)
     }
     allowed := rr.HeaderMap.Get("Allow")
-    if allowed != "HEAD, GET, TEST" {
+    if allowed != "HEAD, GET" {
         t.Errorf("allow header is %s", allowed)
     }
+
+    // methods not in webapp.Methods are not dispatched by the handler names
+    r.Method = "TEST"
+    rr = httptest.NewRecorder()
+    webapp.ServeHTTP(rr, r)
+    if rr.Code != http.StatusMethodNotAllowed {
+        t.Errorf("response code of TEST is %d", rr.Code)
+    }
 }
 
 type Something struct {
@@ -782,3 +793,313 @@ func TestHasPreEarlyReturn(t *testing.T) {
         t.Errorf("response code is %d", rr.Code)
     }
 }
+
+type Override struct {
+    Ctx
+    Perm `DELETE:"ADMIN"`
+}
+
+func (c Override) Post() interface{} {
+    return "post"
+}
+
+func (c Override) Put() interface{} {
+    return "put " + c.Param("name")
+}
+
+func (c Override) Delete() interface{} {
+    return "delete"
+}
+
+func TestMethodOverride(t *testing.T) {
+    webapp := CreateWebApp([]RouteRule{
+        {"/override", Override{}},
+    })
+    webapp.MethodOverride = []string{"put", "DELETE"}
+
+    tests := []struct {
+        method string
+        body string
+        header string
+        code int
+        entity string
+    }{
+        {"POST", "_method=put&name=foo", "", http.StatusOK, "put foo"},
+        {"POST", "name=foo", "PUT", http.StatusOK, "put foo"},
+        {"POST", "_method=DELETE", "", http.StatusUnauthorized, "unauthorized\n"},
+        {"POST", "_method=PATCH", "", http.StatusOK, "post"},
+        {"GET", "", "PUT", http.StatusMethodNotAllowed, "Method Not Allowed\n"},
+        {"POST", "", "delete", http.StatusUnauthorized, "unauthorized\n"},
+    }
+    for i, test := range tests {
+        r := httptest.NewRequest(test.method, "/override", strings.NewReader(test.body))
+        r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+        if test.header != "" {
+            r.Header.Set("X-HTTP-Method-Override", test.header)
+        }
+        rr := httptest.NewRecorder()
+        webapp.ServeHTTP(rr, r)
+        if rr.Code != test.code || rr.Body.String() != test.entity {
+            t.Errorf("#%d got %d `%s`", i, rr.Code, rr.Body.String())
+        }
+        if r.Method != test.method {
+            t.Errorf("#%d method of the request is changed to %s", i, r.Method)
+        }
+    }
+}
+
+type MoreResponses struct {
+    Ctx
+    Provides `GET:"application/json"`
+}
+
+func (c MoreResponses) Get() interface{} {
+    body := struct {
+        Msg string `json:"msg"`
+    }{"oops"}
+    switch c.PathParam("code") {
+    case "201":
+        return c.Created("/new/1", body)
+    case "202":
+        return c.Accepted()
+    case "308":
+        return c.PermanentRedirect("/moved")
+    case "409":
+        return c.Conflict(body)
+    case "410":
+        return c.Gone()
+    case "412":
+        return c.PreconditionFailed()
+    case "413":
+        return c.RequestEntityTooLarge()
+    case "422":
+        return c.UnprocessableEntity(body)
+    case "429":
+        return c.TooManyRequests(30)
+    case "502":
+        return c.BadGateway()
+    case "504":
+        return c.GatewayTimeout(body)
+    }
+    return c.Status(418, body, http.Header{"X-Teapot": {"yes"}})
+}
+
+func TestMoreResponseTypes(t *testing.T) {
+    webapp := CreateWebApp([]RouteRule{
+        {"/more/{code}", MoreResponses{}},
+    })
+    tests := []struct {
+        code int
+        header string
+        value string
+        body string
+    }{
+        {http.StatusCreated, "Location", "/new/1", `{"msg":"oops"}`},
+        {http.StatusAccepted, "", "", ""},
+        {http.StatusPermanentRedirect, "Location", "/moved", ""},
+        {http.StatusConflict, "", "", `{"msg":"oops"}`},
+        {http.StatusGone, "", "", "Gone\n"},
+        {http.StatusPreconditionFailed, "", "", "Precondition Failed\n"},
+        {http.StatusRequestEntityTooLarge, "", "", "Request Entity Too Large\n"},
+        {http.StatusUnprocessableEntity, "", "", `{"msg":"oops"}`},
+        {http.StatusTooManyRequests, "Retry-After", "30", "Too Many Requests\n"},
+        {http.StatusBadGateway, "", "", "Bad Gateway\n"},
+        {http.StatusGatewayTimeout, "", "", `{"msg":"oops"}`},
+        {http.StatusTeapot, "X-Teapot", "yes", `{"msg":"oops"}`},
+    }
+    for _, test := range tests {
+        r := httptest.NewRequest("GET", fmt.Sprintf("/more/%d", test.code), nil)
+        rr := httptest.NewRecorder()
+        webapp.ServeHTTP(rr, r)
+        if rr.Code != test.code {
+            t.Errorf("response code is %d, not %d", rr.Code, test.code)
+        }
+        if test.header != "" && rr.Header().Get(test.header) != test.value {
+            t.Errorf("%d: %s is `%s`", test.code, test.header, rr.Header().Get(test.header))
+        }
+        if rr.Body.String() != test.body {
+            t.Errorf("%d: entity is `%s`", test.code, rr.Body.String())
+        }
+    }
+}
+
+type TypedModel struct {
+    Msg string `json:"msg"`
+}
+
+var errMissing = errors.New("missing")
+
+type Typed struct {
+    Ctx
+    Provides `GET:"application/json"`
+}
+
+func (c *Typed) Get() (*TypedModel, error) {
+    switch c.PathParam("what") {
+    case "missing":
+        return nil, WithStatus(http.StatusNotFound, errMissing)
+    case "bad":
+        return nil, fmt.Errorf("parse: %w", WithStatus(http.StatusBadRequest, errors.New("bad id")))
+    case "broken":
+        return nil, errors.New("broken")
+    case "none":
+        return nil, nil
+    }
+    return &TypedModel{"ok"}, nil
+}
+
+func (c *Typed) Delete() error {
+    if c.PathParam("what") == "missing" {
+        return WithStatus(http.StatusNotFound, errMissing)
+    }
+    return nil
+}
+
+func (c *Typed) Validate(strict bool) error {
+    return nil
+}
+
+func TestTypedHandlers(t *testing.T) {
+    webapp := CreateWebApp([]RouteRule{
+        {"/typed/{what}", Typed{}},
+    })
+    tests := []struct {
+        method string
+        what string
+        code int
+        body string
+    }{
+        {"GET", "ok", http.StatusOK, `{"msg":"ok"}`},
+        {"GET", "missing", http.StatusNotFound, "Not Found\n"},
+        {"GET", "bad", http.StatusBadRequest, "parse: bad id\n"},
+        {"GET", "broken", http.StatusInternalServerError,
+            fmt.Sprintf("Internal Server Error: %d (request id: ", errorCode("broken"))},
+        {"GET", "none", http.StatusNoContent, ""},
+        {"DELETE", "ok", http.StatusNoContent, ""},
+        {"DELETE", "missing", http.StatusNotFound, "Not Found\n"},
+        {"VALIDATE", "ok", http.StatusMethodNotAllowed, "Method Not Allowed\n"},
+    }
+    for _, test := range tests {
+        r := httptest.NewRequest(test.method, "/typed/"+test.what, nil)
+        rr := httptest.NewRecorder()
+        webapp.ServeHTTP(rr, r)
+        if rr.Code != test.code {
+            t.Errorf("%s %s: response code is %d", test.method, test.what, rr.Code)
+        }
+        body := rr.Body.String()
+        if rr.Code == http.StatusInternalServerError {
+            // the request id is random
+            body = strings.TrimSuffix(body, rr.Header().Get(RequestIDHeader) + ")\n")
+        }
+        if body != test.body {
+            t.Errorf("%s %s: entity is `%s`", test.method, test.what, rr.Body.String())
+        }
+        if rr.Code == http.StatusMethodNotAllowed && rr.Header().Get("Allow") != "DELETE, HEAD, GET" {
+            t.Errorf("allow header is %s", rr.Header().Get("Allow"))
+        }
+    }
+}
+
+type ValidationError struct {
+    Field string
+}
+
+func (c *ValidationError) Error() string {
+    return "invalid " + c.Field
+}
+
+var errLocked = errors.New("locked")
+
+type Mapped struct {
+    Ctx
+}
+
+func (c *Mapped) Pre() interface{} {
+    if c.PathParam("what") == "locked" {
+        return errLocked
+    }
+    return nil
+}
+
+func (c *Mapped) Get() (string, error) {
+    switch c.PathParam("what") {
+    case "missing":
+        return "", fmt.Errorf("load: %w", errMissing)
+    case "invalid":
+        return "", fmt.Errorf("check: %w", &ValidationError{"name"})
+    case "panic":
+        panic(errMissing)
+    case "expired":
+        return "", WithStatus(http.StatusUnauthorized, errors.New("expired"))
+    }
+    return "ok", nil
+}
+
+func (c *Mapped) Delete() interface{} {
+    return c.InternalError(fmt.Errorf("delete: %w", errMissing))
+}
+
+func (c *Mapped) Post() (interface{}, error) {
+    var m TypedModel
+    if err := c.Decode(&m); err != nil {
+        return nil, err
+    }
+    return m.Msg, nil
+}
+
+func TestErrorMappers(t *testing.T) {
+    webapp := CreateWebApp([]RouteRule{
+        {"/mapped/{what}", Mapped{}},
+    })
+    webapp.UserProvider = Auther{}
+    webapp.ErrorMappers = []ErrorMapper{
+        ErrorIs(errMissing, http.StatusNotFound),
+        ErrorAs((*ValidationError)(nil), http.StatusUnprocessableEntity),
+        func(ctx *Ctx, err error) interface{} {
+            if errors.Is(err, errLocked) {
+                return ctx.Status(http.StatusLocked, nil, nil)
+            }
+            var de *DecodeError
+            if errors.As(err, &de) {
+                return ctx.BadRequest("malformed", TypedModel{de.Err.Error()})
+            }
+            return nil
+        },
+    }
+    tests := []struct {
+        method string
+        what string
+        contentType string
+        body string
+        code int
+        entity string
+    }{
+        {"GET", "ok", "", "", http.StatusOK, "ok"},
+        {"GET", "missing", "", "", http.StatusNotFound, "Not Found\n"},
+        {"GET", "invalid", "", "", http.StatusUnprocessableEntity, "Unprocessable Entity\n"},
+        {"GET", "panic", "", "", http.StatusNotFound, "Not Found\n"},
+        {"GET", "locked", "", "", http.StatusLocked, ""},
+        {"GET", "expired", "", "", http.StatusUnauthorized, "unauthorized\n"},
+        {"DELETE", "ok", "", "", http.StatusNotFound, "Not Found\n"},
+        {"POST", "ok", "application/json", `{"msg":"hi"}`, http.StatusOK, "hi"},
+        {"POST", "ok", "text/plain", "hi", http.StatusUnsupportedMediaType, "Unsupported Media Type\n"},
+        {"POST", "ok", "application/json", `{"msg"`, http.StatusBadRequest, "{unexpected EOF}"},
+    }
+    for _, test := range tests {
+        r := httptest.NewRequest(test.method, "/mapped/"+test.what, strings.NewReader(test.body))
+        if test.contentType != "" {
+            r.Header.Set("Content-Type", test.contentType)
+        }
+        rr := httptest.NewRecorder()
+        webapp.ServeHTTP(rr, r)
+        if rr.Code != test.code {
+            t.Errorf("%s %s: response code is %d", test.method, test.what, rr.Code)
+        }
+        if rr.Body.String() != test.entity {
+            t.Errorf("%s %s: entity is `%s`", test.method, test.what, rr.Body.String())
+        }
+        if rr.Code == http.StatusUnauthorized && rr.Header().Get("WWW-Authenticate") != `Basic realm="test"` {
+            t.Errorf("%s %s: challenge is `%s`", test.method, test.what, rr.Header().Get("WWW-Authenticate"))
+        }
+    }
+}
@@ -0,0 +1,465 @@
+package vitali
+
+import (
+    "fmt"
+    "io/ioutil"
+    "encoding/json"
+    "path/filepath"
+    "sort"
+    "strconv"
+    "strings"
+    "sync"
+    "reflect"
+    "html/template"
+)
+
+// loadI18n reads the i18n.json dictionary in dir, and the per language
+// dictionaries in its i18n subfolder, e.g. views/i18n/zh-tw.json.
+func loadI18n(dir string) map[string]map[string]template.HTML {
+    i18n := make(map[string]map[string]template.HTML)
+    rawI18n := make(map[string]map[string]template.HTML)
+    content, err := ioutil.ReadFile(filepath.Join(dir, "i18n.json"))
+    if err == nil {
+        err = json.Unmarshal(content, &rawI18n)
+        if err != nil {
+            DefaultLogger.Log(LevelError, "failed to parse i18n.json", "error", err)
+        }
+    }
+    for lang, msgs := range rawI18n {
+        i18n[strings.ToLower(lang)] = msgs
+    }
+
+    files, _ := filepath.Glob(filepath.Join(dir, "i18n", "*.json"))
+    for _, file := range files {
+        lang := strings.ToLower(strings.TrimSuffix(filepath.Base(file), ".json"))
+        msgs := make(map[string]template.HTML)
+        content, err := ioutil.ReadFile(file)
+        if err == nil {
+            err = json.Unmarshal(content, &msgs)
+        }
+        if err != nil {
+            DefaultLogger.Log(LevelError, "failed to load i18n", "file", file, "error", err)
+            continue
+        }
+        if i18n[lang] == nil {
+            i18n[lang] = make(map[string]template.HTML)
+        }
+        for key, msg := range msgs {
+            i18n[lang][key] = msg
+        }
+    }
+    return i18n
+}
+
+// Catalog holds the i18n messages parsed as message formats, e.g.
+//   "Hello {name}"
+//   "{0} left {count, plural, =0 {no comments} one {# comment} other {# comments}}"
+//   "{gender, select, female {her} male {his} other {their}} slides"
+// The message texts are trusted HTML like the .S labels, while the arguments
+// are escaped unless they are of type template.HTML.
+type Catalog struct {
+    messages map[string]map[string][]msgNode
+}
+
+// NewCatalog parses the messages in the i18n.json format. Messages that fail
+// to parse are kept as plain text.
+func NewCatalog(i18n map[string]map[string]template.HTML) *Catalog {
+    catalog := &Catalog{make(map[string]map[string][]msgNode)}
+    for lang, msgs := range i18n {
+        lang = strings.ToLower(lang)
+        catalog.messages[lang] = make(map[string][]msgNode)
+        for key, msg := range msgs {
+            nodes, err := parseMessage(string(msg))
+            if err != nil {
+                DefaultLogger.Log(LevelWarn, "failed to parse message", "key", key, "lang", lang,
+                    "error", err)
+                nodes = []msgNode{textNode(msg)}
+            }
+            catalog.messages[lang][key] = nodes
+        }
+    }
+    return catalog
+}
+
+// Format renders the message key of lang with args. Arguments are referred to
+// by position ({0}, {1}...), or by name when args is a single
+// map[string]interface{} or a list of name and value pairs.
+func (c *Catalog) Format(lang string, key string, args ...interface{}) (template.HTML, error) {
+    lang = strings.ToLower(lang)
+    nodes, ok := c.messages[lang][key]
+    if !ok {
+        return "", fmt.Errorf("message %s not found for language %s", key, lang)
+    }
+    f := msgFormatter{lang: lang, args: args}
+    f.format(nodes, "")
+    return template.HTML(f.buf.String()), f.err
+}
+
+// Has reports whether the message key exists in lang.
+func (c *Catalog) Has(lang string, key string) bool {
+    _, ok := c.messages[strings.ToLower(lang)][key]
+    return ok
+}
+
+// MissingTranslations lists the keys of each language which are present in
+// some other language but missing in it.
+func MissingTranslations(i18n map[string]map[string]template.HTML) map[string][]string {
+    missing := make(map[string][]string)
+    for lang, msgs := range i18n {
+        seen := make(map[string]bool)
+        for _, others := range i18n {
+            for key := range others {
+                if _, ok := msgs[key]; !ok && !seen[key] {
+                    seen[key] = true
+                    missing[lang] = append(missing[lang], key)
+                }
+            }
+        }
+        sort.Strings(missing[lang])
+    }
+    return missing
+}
+
+func (c *Ctx) T(key string, args ...interface{}) template.HTML {
+    if c.app == nil {
+        return ""
+    }
+    return c.app.translate(c, key, args...)
+}
+
+func (c *webApp) translate(ctx *Ctx, key string, args ...interface{}) template.HTML {
+    lang := ctx.ChosenLang
+    if c.Catalog != nil {
+        for _, l := range c.langFallbacks(lang) {
+            if !c.Catalog.Has(l, key) {
+                continue
+            }
+            msg, err := c.Catalog.Format(l, key, args...)
+            if err != nil {
+                ctx.logger().Log(LevelWarn, "failed to format message", "key", key, "lang", l,
+                    "error", err)
+            }
+            return msg
+        }
+    }
+    return c.missingLabel(ctx, key)
+}
+
+// labelCache holds the .S maps built for the I18n and Catalog of a webapp,
+// which are built again when either of them is replaced.
+type labelCache struct {
+    lock sync.Mutex
+    i18n uintptr
+    catalog *Catalog
+    labels map[string]map[string]template.HTML
+}
+
+// labels returns the .S map of the chosen language, filling the keys missing
+// in it with the ones of the fallback languages. Outside DevMode the map is
+// built on the first use of the fallback languages and shared by the
+// requests.
+func (c *webApp) labels(ctx *Ctx) map[string]template.HTML {
+    if c.labelCache == nil || c.DevMode {
+        return c.buildLabels(ctx)
+    }
+    cache := c.labelCache
+    // keyed by the languages in I18n only, not to keep a map for every
+    // language asked for
+    var langs []string
+    for _, lang := range c.langFallbacks(ctx.ChosenLang) {
+        if _, ok := c.I18n[lang]; ok {
+            langs = append(langs, lang)
+        }
+    }
+    key := strings.Join(langs, "|")
+    i18n := reflect.ValueOf(c.I18n).Pointer()
+
+    cache.lock.Lock()
+    defer cache.lock.Unlock()
+    if cache.labels == nil || cache.i18n != i18n || cache.catalog != c.Catalog {
+        cache.labels = make(map[string]map[string]template.HTML)
+        cache.i18n = i18n
+        cache.catalog = c.Catalog
+    }
+    labels, ok := cache.labels[key]
+    if !ok {
+        labels = c.buildLabels(ctx)
+        cache.labels[key] = labels
+    }
+    return labels
+}
+
+func (c *webApp) buildLabels(ctx *Ctx) map[string]template.HTML {
+    langs := c.langFallbacks(ctx.ChosenLang)
+    labels := make(map[string]template.HTML)
+    for i := len(langs) - 1; i >= 0; i-- {
+        for key, label := range c.I18n[langs[i]] {
+            labels[key] = label
+        }
+    }
+    if c.DevMode {
+        for _, msgs := range c.I18n {
+            for key := range msgs {
+                if _, ok := labels[key]; !ok {
+                    labels[key] = c.missingLabel(ctx, key)
+                }
+            }
+        }
+    }
+    return labels
+}
+
+// missingLabel renders nothing for a missing translation, or the key itself
+// in DevMode, in which case it is also logged once.
+func (c *webApp) missingLabel(ctx *Ctx, key string) template.HTML {
+    if !c.DevMode {
+        return ""
+    }
+    lang := ctx.ChosenLang
+    if _, logged := c.missingReported.LoadOrStore(lang+":"+key, true); !logged {
+        ctx.logger().Log(LevelWarn, "missing translation", "key", key, "lang", lang)
+    }
+    return template.HTML("[[" + template.HTMLEscapeString(key) + "]]")
+}
+
+type msgNode interface{}
+
+type textNode string
+
+type argNode string
+
+type hashNode struct{}
+
+type choiceNode struct {
+    arg string
+    plural bool
+    cases map[string][]msgNode
+}
+
+type msgParser struct {
+    src []rune
+    pos int
+}
+
+func parseMessage(src string) ([]msgNode, error) {
+    p := &msgParser{src: []rune(src)}
+    nodes, err := p.parseNodes(false)
+    if err == nil && p.pos < len(p.src) {
+        err = fmt.Errorf("unexpected } at %d", p.pos)
+    }
+    return nodes, err
+}
+
+func (p *msgParser) parseNodes(inPlural bool) (nodes []msgNode, err error) {
+    var text []rune
+    flush := func() {
+        if len(text) > 0 {
+            nodes = append(nodes, textNode(text))
+            text = nil
+        }
+    }
+    for p.pos < len(p.src) {
+        ch := p.src[p.pos]
+        switch {
+        case ch == '\'':
+            p.pos++
+            if p.pos < len(p.src) && p.src[p.pos] == '\'' {
+                text = append(text, '\'')
+                p.pos++
+            } else if p.pos < len(p.src) && strings.ContainsRune("{}#", p.src[p.pos]) {
+                for p.pos < len(p.src) && p.src[p.pos] != '\'' {
+                    text = append(text, p.src[p.pos])
+                    p.pos++
+                }
+                p.pos++
+            } else {
+                text = append(text, '\'')
+            }
+        case ch == '{':
+            flush()
+            p.pos++
+            node, err := p.parseArg(inPlural)
+            if err != nil {
+                return nil, err
+            }
+            nodes = append(nodes, node)
+        case ch == '}':
+            flush()
+            return
+        case ch == '#' && inPlural:
+            flush()
+            nodes = append(nodes, hashNode{})
+            p.pos++
+        default:
+            text = append(text, ch)
+            p.pos++
+        }
+    }
+    flush()
+    return
+}
+
+func (p *msgParser) parseArg(inPlural bool) (msgNode, error) {
+    name := p.parseToken()
+    if name == "" {
+        return nil, fmt.Errorf("missing argument name at %d", p.pos)
+    }
+    p.skipSpace()
+    if p.pos >= len(p.src) {
+        return nil, fmt.Errorf("unclosed argument %s", name)
+    }
+    if p.src[p.pos] == '}' {
+        p.pos++
+        return argNode(name), nil
+    }
+    if p.src[p.pos] != ',' {
+        return nil, fmt.Errorf("unexpected %c at %d", p.src[p.pos], p.pos)
+    }
+    p.pos++
+    kind := p.parseToken()
+    if kind != "plural" && kind != "select" {
+        return nil, fmt.Errorf("unknown argument type %s", kind)
+    }
+    p.skipSpace()
+    if p.pos >= len(p.src) || p.src[p.pos] != ',' {
+        return nil, fmt.Errorf("missing cases for argument %s", name)
+    }
+    p.pos++
+
+    node := choiceNode{arg: name, plural: kind == "plural", cases: make(map[string][]msgNode)}
+    for {
+        p.skipSpace()
+        if p.pos >= len(p.src) {
+            return nil, fmt.Errorf("unclosed argument %s", name)
+        }
+        if p.src[p.pos] == '}' {
+            p.pos++
+            break
+        }
+        selector := p.parseToken()
+        p.skipSpace()
+        if selector == "" || p.pos >= len(p.src) || p.src[p.pos] != '{' {
+            return nil, fmt.Errorf("invalid case for argument %s at %d", name, p.pos)
+        }
+        p.pos++
+        nodes, err := p.parseNodes(inPlural || node.plural)
+        if err != nil {
+            return nil, err
+        }
+        if p.pos >= len(p.src) {
+            return nil, fmt.Errorf("unclosed case %s of argument %s", selector, name)
+        }
+        p.pos++
+        node.cases[selector] = nodes
+    }
+    if _, ok := node.cases["other"]; !ok {
+        return nil, fmt.Errorf("missing other case for argument %s", name)
+    }
+    return node, nil
+}
+
+func (p *msgParser) skipSpace() {
+    for p.pos < len(p.src) && strings.ContainsRune(" \t\r\n", p.src[p.pos]) {
+        p.pos++
+    }
+}
+
+func (p *msgParser) parseToken() string {
+    p.skipSpace()
+    start := p.pos
+    for p.pos < len(p.src) && !strings.ContainsRune(" \t\r\n,{}", p.src[p.pos]) {
+        p.pos++
+    }
+    return string(p.src[start:p.pos])
+}
+
+type msgFormatter struct {
+    lang string
+    args []interface{}
+    buf strings.Builder
+    err error
+}
+
+func (f *msgFormatter) arg(name string) (interface{}, bool) {
+    v, ok := f.lookup(name)
+    if model, isModel := v.(*interface{}); isModel {
+        // {{.M}} is passed to templates as a pointer
+        v = *model
+    }
+    return v, ok
+}
+
+func (f *msgFormatter) lookup(name string) (interface{}, bool) {
+    if i, err := strconv.Atoi(name); err == nil {
+        if i >= 0 && i < len(f.args) {
+            return f.args[i], true
+        }
+        return nil, false
+    }
+    if len(f.args) == 1 {
+        if m, ok := f.args[0].(map[string]interface{}); ok {
+            v, ok := m[name]
+            return v, ok
+        }
+    }
+    for i := 0; i+1 < len(f.args); i += 2 {
+        if f.args[i] == name {
+            return f.args[i+1], true
+        }
+    }
+    return nil, false
+}
+
+func (f *msgFormatter) write(v interface{}) {
+    switch s := v.(type) {
+    case template.HTML:
+        f.buf.WriteString(string(s))
+    default:
+        f.buf.WriteString(template.HTMLEscapeString(fmt.Sprint(v)))
+    }
+}
+
+func (f *msgFormatter) format(nodes []msgNode, number string) {
+    for _, node := range nodes {
+        switch n := node.(type) {
+        case textNode:
+            f.buf.WriteString(string(n))
+        case hashNode:
+            f.buf.WriteString(number)
+        case argNode:
+            v, ok := f.arg(string(n))
+            if !ok {
+                f.err = fmt.Errorf("missing argument %s", n)
+                continue
+            }
+            f.write(v)
+        case choiceNode:
+            v, ok := f.arg(n.arg)
+            if !ok {
+                f.err = fmt.Errorf("missing argument %s", n.arg)
+                continue
+            }
+            if !n.plural {
+                nodes, ok := n.cases[fmt.Sprint(v)]
+                if !ok {
+                    nodes = n.cases["other"]
+                }
+                f.format(nodes, number)
+                continue
+            }
+            num, err := pluralOperand(v)
+            if err != nil {
+                f.err = fmt.Errorf("argument %s: %s", n.arg, err)
+                continue
+            }
+            nodes, ok := n.cases["="+num]
+            if !ok {
+                nodes, ok = n.cases[pluralCategory(f.lang, num)]
+            }
+            if !ok {
+                nodes = n.cases["other"]
+            }
+            f.format(nodes, num)
+        }
+    }
+}
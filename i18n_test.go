@@ -0,0 +1,220 @@
+package vitali
+
+import (
+    "fmt"
+    "testing"
+    "strings"
+    "net/http"
+    "net/url"
+    "html/template"
+    "net/http/httptest"
+)
+
+func TestCatalogFormat(t *testing.T) {
+    catalog := NewCatalog(map[string]map[string]template.HTML{
+        "en-us": {
+            "NAMED": "hello {name}",
+            "ITEMS": "{count, plural, =0 {no items} one {# item} other {# items}}",
+            "OWNER": "{gender, select, female {her} male {his} other {their}} {n, plural, one {slide} other {# slides}}",
+            "QUOTED": "'{literal}' it''s",
+        },
+        "ru": {
+            "FILES": "{0, plural, one {# файл} few {# файла} many {# файлов} other {# файла}}",
+        },
+    })
+
+    tests := []struct {
+        lang string
+        key string
+        args []interface{}
+        expected template.HTML
+    }{
+        {"en-us", "NAMED", []interface{}{"name", "<bob>"}, "hello &lt;bob&gt;"},
+        {"en-us", "NAMED", []interface{}{map[string]interface{}{"name": template.HTML("<b>bob</b>")}}, "hello <b>bob</b>"},
+        {"en-us", "ITEMS", []interface{}{"count", 0}, "no items"},
+        {"en-us", "ITEMS", []interface{}{"count", 1}, "1 item"},
+        {"en-us", "ITEMS", []interface{}{"count", 1.5}, "1.5 items"},
+        {"EN-US", "ITEMS", []interface{}{"count", 3}, "3 items"},
+        {"en-us", "OWNER", []interface{}{"gender", "female", "n", 1}, "her slide"},
+        {"en-us", "OWNER", []interface{}{"gender", "x", "n", 4}, "their 4 slides"},
+        {"en-us", "QUOTED", nil, "{literal} it's"},
+        {"ru", "FILES", []interface{}{1}, "1 файл"},
+        {"ru", "FILES", []interface{}{3}, "3 файла"},
+        {"ru", "FILES", []interface{}{11}, "11 файлов"},
+        {"ru", "FILES", []interface{}{22}, "22 файла"},
+    }
+    for _, test := range tests {
+        msg, err := catalog.Format(test.lang, test.key, test.args...)
+        if err != nil {
+            t.Errorf("%s %s: %s", test.lang, test.key, err)
+        }
+        if msg != test.expected {
+            t.Errorf("%s %s is `%s`", test.lang, test.key, msg)
+        }
+    }
+
+    _, err := catalog.Format("en-us", "NAMED")
+    if err == nil {
+        t.Errorf("missing argument is not reported")
+    }
+    _, err = catalog.Format("en-us", "NOT_EXIST")
+    if err == nil {
+        t.Errorf("missing message is not reported")
+    }
+}
+
+type I18nFormatTest struct {
+    Ctx
+    Provides `GET:"text/html"`
+    Views `GET:"i18n_format_test.html"`
+}
+
+func (c *I18nFormatTest) Get() interface{} {
+    return "<alice>"
+}
+
+func TestI18nFormat(t *testing.T) {
+    r := &http.Request{
+        Method: "GET",
+        Host:   "lunastorm.tw",
+        URL: &url.URL{
+            Path: "/i18nformat",
+        },
+        Header: make(http.Header),
+    }
+    r.Header.Set("Accept-Language", "en-us")
+
+    rr := httptest.NewRecorder()
+    webapp := CreateWebApp([]RouteRule{
+        {"/i18nformat", I18nFormatTest{}},
+    })
+    webapp.LangProvider = &TestLangProvider{}
+    webapp.ServeHTTP(rr, r)
+
+    if rr.Code != http.StatusOK {
+        t.Errorf("response code is %d", rr.Code)
+    }
+    entity := rr.Body.String()
+    if entity != "hi <b>&lt;alice&gt;</b>, 2 items\n" {
+        t.Errorf("entity is `%s`", entity)
+    }
+
+    r.Header.Set("Accept-Language", "zh-tw")
+    rr = httptest.NewRecorder()
+    webapp.ServeHTTP(rr, r)
+    entity = rr.Body.String()
+    if entity != "嗨 <b>&lt;alice&gt;</b>, 2 個項目\n" {
+        t.Errorf("entity is `%s`", entity)
+    }
+}
+
+func TestMissingTranslations(t *testing.T) {
+    missing := MissingTranslations(map[string]map[string]template.HTML{
+        "en-us": {"A": "a", "B": "b", "C": "c"},
+        "zh-tw": {"A": "a"},
+        "ja": {"C": "c", "D": "d"},
+    })
+    if len(missing) != 3 {
+        t.Errorf("missing is %v", missing)
+    }
+    if strings.Join(missing["en-us"], ",") != "D" {
+        t.Errorf("en-us missing %v", missing["en-us"])
+    }
+    if strings.Join(missing["zh-tw"], ",") != "B,C,D" {
+        t.Errorf("zh-tw missing %v", missing["zh-tw"])
+    }
+    if strings.Join(missing["ja"], ",") != "A,B" {
+        t.Errorf("ja missing %v", missing["ja"])
+    }
+}
+
+type I18nFallbackTest struct {
+    Ctx
+    Provides `GET:"text/html"`
+    Views `GET:"i18n_fallback_test.html"`
+}
+
+func (c *I18nFallbackTest) Get() interface{} {
+    return ""
+}
+
+func TestI18nFallback(t *testing.T) {
+    r := &http.Request{
+        Method: "GET",
+        Host:   "lunastorm.tw",
+        URL: &url.URL{
+            Path: "/i18nfallback",
+        },
+        Header: make(http.Header),
+    }
+    webapp := CreateWebApp([]RouteRule{
+        {"/i18nfallback", I18nFallbackTest{}},
+    })
+    webapp.I18n["en-us"]["ONLY_EN"] = "en"
+    webapp.I18n["zh"] = map[string]template.HTML{"HI": "你好"}
+    webapp.Catalog = NewCatalog(webapp.I18n)
+    webapp.LangProvider = &TestLangProvider{}
+
+    tests := []struct {
+        lang string
+        defaultLang string
+        devMode bool
+        expected string
+    }{
+        {"zh-tw", "", false, "嗨  \n"},
+        {"zh-hk", "", false, "你好  \n"},
+        {"zh-tw", "en-us", false, "嗨 en en\n"},
+        {"fr", "en-us", false, "hi en en\n"},
+        {"zh-tw", "", true, "嗨 [[ONLY_EN]] [[ONLY_EN]]\n"},
+    }
+    for _, test := range tests {
+        r.Header.Set("Accept-Language", test.lang)
+        webapp.Settings["DEFAULT_LANG"] = test.defaultLang
+        webapp.DevMode = test.devMode
+        rr := httptest.NewRecorder()
+        webapp.ServeHTTP(rr, r)
+        if rr.Code != http.StatusOK {
+            t.Errorf("response code is %d", rr.Code)
+        }
+        entity := rr.Body.String()
+        if entity != test.expected {
+            t.Errorf("entity of %s is `%s`", test.lang, entity)
+        }
+    }
+}
+
+func TestLabelCache(t *testing.T) {
+    webapp := CreateWebApp([]RouteRule{
+        {"/i18nfallback", I18nFallbackTest{}},
+    })
+    webapp.I18n["en-us"]["ONLY_EN"] = "en"
+    webapp.Settings["DEFAULT_LANG"] = "en-us"
+    ctx := &Ctx{ChosenLang: "zh-TW", app: &webapp}
+
+    labels := webapp.labels(ctx)
+    if labels["ONLY_EN"] != "en" {
+        t.Errorf("fallback label is `%s`", labels["ONLY_EN"])
+    }
+    labels["ONLY_EN"] = "cached"
+    if webapp.labels(ctx)["ONLY_EN"] != "cached" {
+        t.Errorf("labels are built again")
+    }
+    webapp.Catalog = NewCatalog(webapp.I18n)
+    if webapp.labels(ctx)["ONLY_EN"] != "en" {
+        t.Errorf("labels are not built again for the new catalog")
+    }
+
+    // the unknown languages share the map of the default language
+    for i := 0; i < 10; i++ {
+        webapp.labels(&Ctx{ChosenLang: fmt.Sprintf("xx-%d", i), app: &webapp})
+    }
+    if n := len(webapp.labelCache.labels); n != 2 {
+        t.Errorf("%d maps are cached", n)
+    }
+
+    webapp.DevMode = true
+    webapp.I18n["en-us"]["ONLY_EN"] = "edited"
+    if webapp.labels(ctx)["ONLY_EN"] != "edited" {
+        t.Errorf("labels are cached in DevMode")
+    }
+}
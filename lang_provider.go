@@ -1,5 +1,15 @@
 package vitali
 
+import (
+    "sort"
+    "time"
+    "strconv"
+    "strings"
+    "path"
+    "net/http"
+    "html/template"
+)
+
 type LangProvider interface {
     Select(*Ctx) string
 }
@@ -10,3 +20,295 @@ type EmptyLangProvider struct {
 func (c *EmptyLangProvider) Select(ctx *Ctx) string {
     return ""
 }
+
+// langFallbacks lists the languages to try for lang, from the most specific
+// one to the default language set in Settings["DEFAULT_LANG"], e.g.
+// zh-tw, zh, en-us, en.
+func (c *webApp) langFallbacks(lang string) (langs []string) {
+    seen := make(map[string]bool)
+    for _, l := range []string{lang, c.Settings["DEFAULT_LANG"]} {
+        l = strings.ToLower(l)
+        for l != "" {
+            if !seen[l] {
+                seen[l] = true
+                langs = append(langs, l)
+            }
+            i := strings.LastIndex(l, "-")
+            if i < 0 {
+                break
+            }
+            l = l[:i]
+        }
+    }
+    return
+}
+
+type LangSource string
+
+const (
+    LangFromQuery LangSource = "query"
+    LangFromCookie LangSource = "cookie"
+    LangFromPath LangSource = "path"
+    LangFromHeader LangSource = "header"
+)
+
+// StandardLangProvider selects the language by the sources in Order, the
+// first one giving a supported language wins:
+//   query: the QueryParam parameter, e.g. ?lang=zh-tw
+//   cookie: the CookieName cookie
+//   path: the language prefix, e.g. /zh-tw/user/foo, if webapp.LangPrefix is
+//     set
+//   header: the Accept-Language header
+// Default is used if none of them matches. The chosen language is sent in the
+// Content-Language header, and the Cookie and Accept-Language headers in Vary
+// if their sources are in Order.
+type StandardLangProvider struct {
+    Langs []string
+    Default string
+    Order []LangSource
+    QueryParam string
+    CookieName string
+    // the language chosen by the query parameter is kept in the cookie for
+    // CookieMaxAge if it is positive
+    CookieMaxAge time.Duration
+}
+
+// CreateStandardLangProvider supports the languages in i18n, and selects by
+// the order given or by cookie and then Accept-Language if not given.
+func CreateStandardLangProvider(i18n map[string]map[string]template.HTML,
+        order ...LangSource) *StandardLangProvider {
+    langs := make([]string, 0, len(i18n))
+    for lang := range i18n {
+        langs = append(langs, strings.ToLower(lang))
+    }
+    sort.Strings(langs)
+    if len(order) == 0 {
+        order = []LangSource{LangFromCookie, LangFromHeader}
+    }
+    return &StandardLangProvider{
+        Langs: langs,
+        Order: order,
+        QueryParam: "lang",
+        CookieName: "lang",
+    }
+}
+
+func (c *StandardLangProvider) Select(ctx *Ctx) (lang string) {
+    defer func() {
+        if lang != "" {
+            ctx.ResponseWriter.Header().Set("Content-Language", lang)
+        }
+    }()
+
+    // the sources after the one choosing the language still matter for the
+    // requests without it
+    for _, source := range c.Order {
+        switch source {
+        case LangFromCookie:
+            addVary(ctx.ResponseWriter.Header(), "Cookie")
+        case LangFromHeader:
+            addVary(ctx.ResponseWriter.Header(), "Accept-Language")
+        }
+    }
+
+    for _, source := range c.Order {
+        switch source {
+        case LangFromQuery:
+            lang = c.Match(ctx.Request.URL.Query().Get(c.QueryParam))
+            if lang != "" && c.CookieMaxAge > 0 {
+                ctx.SetCookie(&http.Cookie{
+                    Name: c.CookieName,
+                    Value: lang,
+                    Path: "/",
+                    Expires: time.Now().Add(c.CookieMaxAge),
+                    MaxAge: int(c.CookieMaxAge / time.Second),
+                })
+            }
+        case LangFromCookie:
+            lang = c.Match(ctx.Cookie(c.CookieName))
+        case LangFromPath:
+            lang = c.supported(ctx.pathLang)
+        case LangFromHeader:
+            lang = c.Negotiate(ctx.Header("Accept-Language"))
+        }
+        if lang != "" {
+            return
+        }
+    }
+    return c.Default
+}
+
+// addVary adds name to the Vary header unless it is there already.
+func addVary(header http.Header, name string) {
+    for _, value := range header.Values("Vary") {
+        for _, v := range strings.Split(value, ",") {
+            if strings.EqualFold(strings.TrimSpace(v), name) {
+                return
+            }
+        }
+    }
+    header.Add("Vary", name)
+}
+
+func (c *StandardLangProvider) supported(lang string) string {
+    lang = strings.ToLower(lang)
+    for _, l := range c.Langs {
+        if l == lang {
+            return l
+        }
+    }
+    return ""
+}
+
+// Match returns the supported language for the language range by the RFC 4647
+// lookup, e.g. zh-hant-tw matches zh-hant or zh, then by the basic filtering,
+// e.g. en matches en-us. The wildcard * matches Default if it is supported, or
+// else the first language. It returns "" if nothing matches.
+func (c *StandardLangProvider) Match(langRange string) string {
+    langRange = strings.ToLower(strings.TrimSpace(langRange))
+    if langRange == "" {
+        return ""
+    }
+    if langRange == "*" {
+        if lang := c.supported(c.Default); lang != "" {
+            return lang
+        } else if len(c.Langs) > 0 {
+            return c.Langs[0]
+        }
+        return ""
+    }
+    for tag := langRange; tag != ""; {
+        if lang := c.supported(tag); lang != "" {
+            return lang
+        }
+        i := strings.LastIndex(tag, "-")
+        if i < 0 {
+            break
+        }
+        tag = tag[:i]
+        if len(tag) >= 2 && tag[len(tag)-2] == '-' {
+            // single letter subtags are not used alone
+            tag = tag[:len(tag)-2]
+        }
+    }
+    for _, l := range c.Langs {
+        if strings.HasPrefix(l, langRange+"-") {
+            return l
+        }
+    }
+    return ""
+}
+
+type langWithPriority struct {
+    lang string
+    q float64
+}
+
+// Negotiate returns the supported language with the highest priority in the
+// Accept-Language header value.
+func (c *StandardLangProvider) Negotiate(acceptLanguage string) string {
+    ranges := make([]langWithPriority, 0)
+    for _, part := range strings.Split(acceptLanguage, ",") {
+        params := strings.Split(part, ";")
+        q := 1.0
+        for _, param := range params[1:] {
+            kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+            if len(kv) == 2 && strings.TrimSpace(kv[0]) == "q" {
+                var err error
+                q, err = strconv.ParseFloat(strings.TrimSpace(kv[1]), 64)
+                if err != nil {
+                    q = 0
+                }
+            }
+        }
+        if q > 0 && strings.TrimSpace(params[0]) != "" {
+            ranges = append(ranges, langWithPriority{strings.TrimSpace(params[0]), q})
+        }
+    }
+    sort.SliceStable(ranges, func(i, j int) bool {
+        return ranges[i].q > ranges[j].q
+    })
+    for _, r := range ranges {
+        if lang := c.Match(r.lang); lang != "" {
+            return lang
+        }
+    }
+    return ""
+}
+
+// splitLangPrefix splits the language prefix from the path if LangPrefix is
+// enabled and the first segment is a language in I18n, e.g. /zh-tw/user/foo
+// is split into zh-tw and /user/foo.
+func (c *webApp) splitLangPrefix(path string) (lang string, rest string) {
+    parts := strings.SplitN(strings.TrimPrefix(path, "/"), "/", 2)
+    lang = strings.ToLower(parts[0])
+    if _, ok := c.I18n[lang]; !ok || lang == "" {
+        return "", path
+    }
+    rest = "/"
+    if len(parts) == 2 {
+        rest += parts[1]
+    }
+    return
+}
+
+// langRedirected tells if an unprefixed request to path is redirected, which
+// is when a rule matches it and it is not in LangPrefixExclude by path.Match.
+func (c *webApp) langRedirected(urlPath string) bool {
+    for _, pattern := range c.LangPrefixExclude {
+        if matched, _ := path.Match(pattern, urlPath); matched {
+            return false
+        }
+    }
+    for _, mapping := range c.PatternMappings {
+        if mapping.Re.MatchString(urlPath) {
+            return true
+        }
+    }
+    return false
+}
+
+// langRedirect returns where to redirect an unprefixed request to, which is
+// the same path prefixed by the language selected by the LangProvider or the
+// default language.
+func (c *webApp) langRedirect(ctx *Ctx) string {
+    lang := strings.ToLower(c.LangProvider.Select(ctx))
+    if _, ok := c.I18n[lang]; !ok || lang == "" {
+        lang = strings.ToLower(c.Settings["DEFAULT_LANG"])
+        if _, ok := c.I18n[lang]; !ok || lang == "" {
+            return ""
+        }
+    }
+    ctx.ResponseWriter.Header().Del("Content-Language")
+    return ctx.LangURL(lang)
+}
+
+// LangURL returns the URL of the current page in lang, for language switchers
+// when the webapp uses language prefixed paths.
+func (c *Ctx) LangURL(lang string) string {
+    path := c.Request.URL.Path
+    if c.pathLang != "" {
+        path = path[len(c.pathLang)+1:]
+        if path == "" {
+            path = "/"
+        }
+    }
+    uri := c.LocalURL(path, lang)
+    if c.Request.URL.RawQuery != "" {
+        uri += "?" + c.Request.URL.RawQuery
+    }
+    return uri
+}
+
+// LocalURL prefixes path with the language of the current request, or with
+// lang if given.
+func (c *Ctx) LocalURL(path string, lang ...string) string {
+    prefix := c.pathLang
+    if len(lang) > 0 {
+        prefix = strings.ToLower(lang[0])
+    }
+    if prefix == "" {
+        return path
+    }
+    return "/" + prefix + path
+}
@@ -0,0 +1,212 @@
+package vitali
+
+import (
+    "testing"
+    "net/http"
+    "net/url"
+    "html/template"
+    "net/http/httptest"
+)
+
+type LangTest struct {
+    Ctx
+}
+
+func (c *LangTest) Get() interface{} {
+    return c.ChosenLang
+}
+
+func TestLangMatch(t *testing.T) {
+    provider := CreateStandardLangProvider(map[string]map[string]template.HTML{
+        "en-us": {},
+        "zh-TW": {},
+        "zh": {},
+        "fr": {},
+    })
+    provider.Default = "en-us"
+    tests := map[string]string{
+        "en-US": "en-us",
+        "en": "en-us",
+        "zh-hant-tw": "zh",
+        "zh-tw": "zh-tw",
+        "fr-ca": "fr",
+        "*": "en-us",
+        "de": "",
+    }
+    for langRange, expected := range tests {
+        lang := provider.Match(langRange)
+        if lang != expected {
+            t.Errorf("%s matches `%s`", langRange, lang)
+        }
+    }
+    provider.Default = "de"
+    if lang := provider.Match("*"); lang != "en-us" {
+        t.Errorf("* matches unsupported default `%s`", lang)
+    }
+    provider.Default = "en-us"
+
+    negotiations := map[string]string{
+        "de-de, fr;q=0.5, zh-tw;q=0.8": "zh-tw",
+        "de, en;q=0.1": "en-us",
+        "de, zh-tw;q=0": "",
+        "": "",
+    }
+    for header, expected := range negotiations {
+        lang := provider.Negotiate(header)
+        if lang != expected {
+            t.Errorf("%s negotiates `%s`", header, lang)
+        }
+    }
+}
+
+func TestStandardLangProvider(t *testing.T) {
+    webapp := CreateWebApp([]RouteRule{
+        {"/lang", LangTest{}},
+        {"/zh-tw/lang", LangTest{}},
+    })
+    provider := CreateStandardLangProvider(webapp.I18n, LangFromQuery, LangFromCookie,
+        LangFromPath, LangFromHeader)
+    provider.Default = "en-us"
+    webapp.LangProvider = provider
+
+    tests := []struct {
+        path string
+        query string
+        cookie string
+        acceptLang string
+        expected string
+    }{
+        {"/lang", "", "", "", "en-us"},
+        {"/lang", "", "", "fr, zh;q=0.5", "zh-tw"},
+        // the path is only a source with webapp.LangPrefix
+        {"/zh-tw/lang", "", "", "en", "en-us"},
+        {"/lang", "", "zh-tw", "en", "zh-tw"},
+        {"/lang", "", "xx", "en", "en-us"},
+        {"/lang", "lang=en-US", "zh-tw", "zh", "en-us"},
+    }
+    for _, test := range tests {
+        r := &http.Request{
+            Method: "GET",
+            Host:   "lunastorm.tw",
+            URL: &url.URL{
+                Path: test.path,
+                RawQuery: test.query,
+            },
+            Header: make(http.Header),
+        }
+        r.Header.Set("Accept-Language", test.acceptLang)
+        if test.cookie != "" {
+            r.AddCookie(&http.Cookie{Name: "lang", Value: test.cookie})
+        }
+        rr := httptest.NewRecorder()
+        webapp.ServeHTTP(rr, r)
+
+        entity := rr.Body.String()
+        if entity != test.expected {
+            t.Errorf("%v: lang is `%s`", test, entity)
+        }
+        if rr.Header().Get("Content-Language") != test.expected {
+            t.Errorf("%v: content-language is `%s`", test, rr.Header().Get("Content-Language"))
+        }
+    }
+
+    r := &http.Request{
+        Method: "GET",
+        Host:   "lunastorm.tw",
+        URL: &url.URL{
+            Path: "/lang",
+        },
+        Header: make(http.Header),
+    }
+    rr := httptest.NewRecorder()
+    webapp.ServeHTTP(rr, r)
+    if vary := rr.Header().Values("Vary"); len(vary) != 2 || vary[0] != "Cookie" || vary[1] != "Accept-Language" {
+        t.Errorf("vary header is `%v`", vary)
+    }
+
+    r.AddCookie(&http.Cookie{Name: "lang", Value: "zh-tw"})
+    rr = httptest.NewRecorder()
+    webapp.ServeHTTP(rr, r)
+    if vary := rr.Header().Values("Vary"); len(vary) != 2 || vary[1] != "Accept-Language" {
+        t.Errorf("vary header chosen by cookie is `%v`", vary)
+    }
+    if rr.Header().Get("Set-Cookie") != "" {
+        t.Errorf("cookie is set without CookieMaxAge")
+    }
+}
+
+type LangURLTest struct {
+    Ctx
+}
+
+func (c *LangURLTest) Get() interface{} {
+    return c.ChosenLang + " " + c.LangURL("en-us") + " " + c.LocalURL("/foo")
+}
+
+func TestLangPrefix(t *testing.T) {
+    webapp := CreateWebApp([]RouteRule{
+        {"/lang", LangURLTest{}},
+        {"/lang/{sub}", LangURLTest{}},
+        {"/", LangURLTest{}},
+    })
+    // the prefix wins over the sources before LangFromPath
+    provider := CreateStandardLangProvider(webapp.I18n, LangFromHeader, LangFromPath)
+    webapp.LangProvider = provider
+    webapp.LangPrefix = true
+    webapp.LangPrefixExclude = []string{"/lang/*"}
+
+    tests := []struct {
+        method string
+        uri string
+        acceptLang string
+        code int
+        expected string
+    }{
+        {"GET", "/zh-tw/lang", "en", http.StatusOK, "zh-tw /en-us/lang /zh-tw/foo"},
+        {"GET", "/EN-US/lang?a=b", "", http.StatusOK, "en-us /en-us/lang?a=b /en-us/foo"},
+        {"GET", "/zh-tw", "", http.StatusOK, "zh-tw /en-us/ /zh-tw/foo"},
+        {"GET", "/lang?a=b", "zh", http.StatusFound, "/zh-tw/lang?a=b"},
+        {"HEAD", "/", "en", http.StatusFound, "/en-us/"},
+        {"GET", "/lang", "fr", http.StatusOK, " /en-us/lang /foo"},
+        {"GET", "/metrics", "zh", http.StatusNotFound, "Not Found\n"},
+        {"GET", "/lang/x", "zh", http.StatusOK, "zh-tw /en-us/lang/x /foo"},
+    }
+    for _, test := range tests {
+        u, _ := url.Parse(test.uri)
+        r := &http.Request{
+            Method: test.method,
+            Host:   "lunastorm.tw",
+            URL: u,
+            Header: make(http.Header),
+        }
+        r.Header.Set("Accept-Language", test.acceptLang)
+        rr := httptest.NewRecorder()
+        webapp.ServeHTTP(rr, r)
+
+        if rr.Code != test.code {
+            t.Errorf("%s: response code is %d", test.uri, rr.Code)
+        }
+        if test.code == http.StatusFound {
+            if rr.Header().Get("Location") != test.expected {
+                t.Errorf("%s: location is `%s`", test.uri, rr.Header().Get("Location"))
+            }
+        } else if rr.Body.String() != test.expected {
+            t.Errorf("%s: entity is `%s`", test.uri, rr.Body.String())
+        }
+    }
+
+    webapp.Settings["DEFAULT_LANG"] = "en-us"
+    r := &http.Request{
+        Method: "GET",
+        Host:   "lunastorm.tw",
+        URL: &url.URL{
+            Path: "/lang",
+        },
+        Header: make(http.Header),
+    }
+    rr := httptest.NewRecorder()
+    webapp.ServeHTTP(rr, r)
+    if rr.Code != http.StatusFound || rr.Header().Get("Location") != "/en-us/lang" {
+        t.Errorf("response code is %d, location is `%s`", rr.Code, rr.Header().Get("Location"))
+    }
+}
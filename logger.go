@@ -0,0 +1,157 @@
+package vitali
+
+import (
+    "fmt"
+    "log"
+    "strings"
+    "strconv"
+    "context"
+    "log/slog"
+    "sync/atomic"
+)
+
+// Level is the severity of a log record, with the same values as slog.Level.
+type Level int
+
+const (
+    LevelDebug Level = -4
+    LevelInfo Level = 0
+    LevelWarn Level = 4
+    LevelError Level = 8
+)
+
+func (c Level) String() string {
+    switch {
+    case c < LevelInfo:
+        return "DEBUG"
+    case c < LevelWarn:
+        return "INFO"
+    case c < LevelError:
+        return "WARN"
+    }
+    return "ERROR"
+}
+
+// Logger receives the log records of the framework. The keyvals are the
+// fields of the record as alternating keys and values.
+type Logger interface {
+    Log(level Level, msg string, keyvals ...interface{})
+}
+
+// DefaultLogger logs the messages while creating the webapps, like loading
+// the views, and is the Logger of the webapps created afterwards.
+var DefaultLogger Logger = &StdLogger{}
+
+// StdLogger writes the records at or above Level in the logfmt style, like
+// INFO request method=GET path=/foo, to Logger or the standard logger.
+type StdLogger struct {
+    Logger *log.Logger
+    Level Level
+}
+
+func (c *StdLogger) Log(level Level, msg string, keyvals ...interface{}) {
+    if level < c.Level {
+        return
+    }
+    line := level.String() + " " + msg
+    for i := 0; i < len(keyvals); i += 2 {
+        var value interface{} = "MISSING"
+        if i+1 < len(keyvals) {
+            value = keyvals[i+1]
+        }
+        line += fmt.Sprintf(" %s=%s", keyvals[i], logfmtValue(value))
+    }
+    if c.Logger != nil {
+        c.Logger.Print(line)
+    } else {
+        log.Print(line)
+    }
+}
+
+func logfmtValue(value interface{}) string {
+    s := fmt.Sprint(value)
+    if s == "" || strings.ContainsAny(s, " =\"\n\t") {
+        return strconv.Quote(s)
+    }
+    return s
+}
+
+type slogLogger struct {
+    logger *slog.Logger
+}
+
+// SlogLogger adapts a slog.Logger, whose handler decides the levels to log.
+func SlogLogger(logger *slog.Logger) Logger {
+    return slogLogger{logger}
+}
+
+func (c slogLogger) Log(level Level, msg string, keyvals ...interface{}) {
+    c.logger.Log(context.Background(), slog.Level(level), msg, keyvals...)
+}
+
+type loggerBox struct {
+    logger Logger
+}
+
+// sharedLogger passes the records to the Logger of the webapp from the
+// goroutines in the background, like the view watcher, which cannot see the
+// copies of the webapp. ServeHTTP updates it when the Logger is replaced.
+type sharedLogger struct {
+    value atomic.Value
+    // the loggerTarget last passed to the background loggers
+    target atomic.Value
+}
+
+type loggerTarget struct {
+    logger Logger
+    provider UserProvider
+}
+
+func newSharedLogger(logger Logger) *sharedLogger {
+    c := &sharedLogger{}
+    c.set(logger)
+    return c
+}
+
+func (c *sharedLogger) set(logger Logger) {
+    c.value.Store(loggerBox{logger})
+}
+
+func (c *sharedLogger) Log(level Level, msg string, keyvals ...interface{}) {
+    c.value.Load().(loggerBox).logger.Log(level, msg, keyvals...)
+}
+
+// sameValue compares the interface values, which are not the same if they
+// cannot be compared.
+func sameValue(a interface{}, b interface{}) (same bool) {
+    defer func() {
+        recover()
+    }()
+    return a == b
+}
+
+// propagateLogger passes the Logger of the webapp to the view watcher and the
+// providers logging in the background, when it or the UserProvider is changed
+// since the last request.
+func (c *webApp) propagateLogger() {
+    logger := c.logger()
+    if c.watcherLogger == nil {
+        setProviderLogger(c.UserProvider, logger)
+        return
+    }
+    last, ok := c.watcherLogger.target.Load().(loggerTarget)
+    if ok && sameValue(last.logger, logger) && sameValue(last.provider, c.UserProvider) {
+        return
+    }
+    c.watcherLogger.set(logger)
+    setProviderLogger(c.UserProvider, logger)
+    c.watcherLogger.target.Store(loggerTarget{logger, c.UserProvider})
+}
+
+// logger returns the Logger of the webapp, or the DefaultLogger.
+func (c *webApp) logger() Logger {
+    if c.Logger != nil {
+        return c.Logger
+    }
+    return DefaultLogger
+}
@@ -0,0 +1,134 @@
+package vitali
+
+import (
+    "log"
+    "bytes"
+    "testing"
+    "strings"
+    "log/slog"
+    "net/http"
+    "encoding/json"
+    "net/http/httptest"
+)
+
+type logRecord struct {
+    level Level
+    msg string
+    fields map[string]interface{}
+}
+
+type recordLogger struct {
+    records []logRecord
+}
+
+func (c *recordLogger) Log(level Level, msg string, keyvals ...interface{}) {
+    fields := make(map[string]interface{})
+    for i := 0; i+1 < len(keyvals); i += 2 {
+        fields[keyvals[i].(string)] = keyvals[i+1]
+    }
+    c.records = append(c.records, logRecord{level, msg, fields})
+}
+
+func TestAccessLog(t *testing.T) {
+    webapp := CreateWebApp([]RouteRule{
+        {"/something/{id1}", Something{}},
+        {"/panic", Panikr{}},
+    })
+    logger := &recordLogger{}
+    webapp.Logger = logger
+    webapp.AccessLogLevel = LevelDebug
+
+    r := httptest.NewRequest("GET", "/something/foo", nil)
+    r.RemoteAddr = "10.0.0.1:1234"
+    webapp.ServeHTTP(httptest.NewRecorder(), r)
+    webapp.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/panic", nil))
+
+    if len(logger.records) != 2 {
+        t.Fatalf("records are %v", logger.records)
+    }
+    record := logger.records[0]
+    if record.level != LevelDebug || record.msg != "request" {
+        t.Errorf("record is %v", record)
+    }
+    expected := map[string]interface{}{
+        "method": "GET",
+        "path": "/something/foo",
+        "route": "/something/{id1}",
+        "status": http.StatusOK,
+        "bytes": 3,
+        "user": "",
+        "remote": "10.0.0.1",
+    }
+    for key, value := range expected {
+        if record.fields[key] != value {
+            t.Errorf("%s is %v", key, record.fields[key])
+        }
+    }
+    record = logger.records[1]
+    if record.level != LevelError || record.fields["code"] != errorCode("panic!!") ||
+            !strings.HasPrefix(record.fields["error"].(string), "panic!!") {
+        t.Errorf("record is %v", record)
+    }
+}
+
+func TestStdLogger(t *testing.T) {
+    buf := &bytes.Buffer{}
+    logger := &StdLogger{Logger: log.New(buf, "", 0), Level: LevelWarn}
+    logger.Log(LevelInfo, "hidden")
+    logger.Log(LevelWarn, "missing translation", "key", "HI", "lang", "zh tw", "count", 1)
+    if buf.String() != "WARN missing translation key=HI lang=\"zh tw\" count=1\n" {
+        t.Errorf("log is `%s`", buf.String())
+    }
+}
+
+func TestSlogLogger(t *testing.T) {
+    buf := &bytes.Buffer{}
+    logger := SlogLogger(slog.New(slog.NewJSONHandler(buf, &slog.HandlerOptions{Level: slog.LevelWarn})))
+    logger.Log(LevelInfo, "hidden")
+    logger.Log(LevelError, "failed", "error", "boom")
+    var record map[string]interface{}
+    err := json.Unmarshal(buf.Bytes(), &record)
+    if err != nil || record["level"] != "ERROR" || record["msg"] != "failed" || record["error"] != "boom" {
+        t.Errorf("log is `%s`", buf.String())
+    }
+}
+
+func TestDumpRequest(t *testing.T) {
+    webapp := CreateWebApp([]RouteRule{
+        {"/something/{id1}", Something{}},
+    })
+    buf := &bytes.Buffer{}
+    webapp.Logger = &StdLogger{Logger: log.New(buf, "", 0)}
+    webapp.DumpRequest = true
+    webapp.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/something/foo", nil))
+    if !strings.Contains(buf.String(), "INFO request dump dump=\"GET /something/foo HTTP/1.1") {
+        t.Errorf("log is `%s`", buf.String())
+    }
+}
+
+func TestWatcherLogger(t *testing.T) {
+    webapp := CreateWebApp([]RouteRule{
+        {"/something/{id1}", Something{}},
+    })
+    provider := &HtpasswdUserProvider{logger: newSharedLogger(DefaultLogger)}
+    webapp.UserProvider = CreateChainedUserProvider(provider)
+    logger := &recordLogger{}
+    webapp.Logger = logger
+    webapp.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/something/foo", nil))
+
+    webapp.watcherLogger.Log(LevelError, "view watcher error")
+    provider.logger.Log(LevelError, "htpasswd watcher error")
+    if len(logger.records) != 3 || logger.records[1].msg != "view watcher error" ||
+            logger.records[2].msg != "htpasswd watcher error" {
+        t.Errorf("records are %v", logger.records)
+    }
+
+    // passed again when the Logger is replaced
+    replaced := &recordLogger{}
+    webapp.Logger = replaced
+    webapp.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/something/foo", nil))
+    provider.logger.Log(LevelError, "htpasswd watcher error")
+    if len(replaced.records) != 2 || len(logger.records) != 3 {
+        t.Errorf("records are %v and %v", logger.records, replaced.records)
+    }
+}
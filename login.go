@@ -0,0 +1,128 @@
+package vitali
+
+import (
+    "bytes"
+    "strings"
+    "net/url"
+    "net/http"
+    "html/template"
+)
+
+// the query parameter of the login page for where to go after logging in
+const ReturnToParam = "return_to"
+
+// CredentialChecker verifies the user name and password submitted to Login,
+// and returns the roles of the user. HtpasswdUserProvider is one.
+type CredentialChecker interface {
+    CheckCredentials(user string, password string) (roles []string, ok bool)
+}
+
+var defaultLoginTemplate = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Login</title></head>
+<body>
+<form method="post">
+{{.C.CSRFField}}
+{{if .M.Failed}}<p>Wrong user name or password.</p>{{end}}
+<input type="hidden" name="` + ReturnToParam + `" value="{{.M.ReturnTo}}">
+<p><label>User <input type="text" name="user" value="{{.M.User}}" autofocus></label></p>
+<p><label>Password <input type="password" name="password"></label></p>
+<p><input type="submit" value="Login"></p>
+</form>
+</body>
+</html>
+`))
+
+type LoginModel struct {
+    User string
+    ReturnTo string
+    Failed bool
+}
+
+// Login is a resource which shows the login form by GET, and logs in the
+// session by POST with the user and password parameters, then redirects to
+// the return_to parameter. Template replaces the built-in form, and is
+// executed with .M as the LoginModel, and .S and .C like the views.
+type Login struct {
+    Ctx
+    Checker CredentialChecker
+    Template *template.Template
+}
+
+func (c *Login) render(model LoginModel) interface{} {
+    t := c.Template
+    if t == nil {
+        t = defaultLoginTemplate
+    }
+    var m interface{} = model
+    data := struct {
+        S map[string]template.HTML
+        M *interface{}
+        C *Ctx
+    }{
+        c.app.labels(&c.Ctx),
+        &m,
+        &c.Ctx,
+    }
+    var buf bytes.Buffer
+    err := t.Execute(&buf, data)
+    if err != nil {
+        return c.InternalError(err)
+    }
+    c.ResponseWriter.Header().Set("Content-Type", "text/html; charset=utf-8")
+    return buf.String()
+}
+
+func (c *Login) Get() interface{} {
+    return c.render(LoginModel{ReturnTo: SafeReturnTo(c.Param(ReturnToParam), "")})
+}
+
+func (c *Login) Post() interface{} {
+    user := c.Param("user")
+    roles, ok := c.Checker.CheckCredentials(user, c.Param("password"))
+    returnTo := SafeReturnTo(c.Param(ReturnToParam), "")
+    if !ok || user == "" {
+        return c.render(LoginModel{User: user, ReturnTo: returnTo, Failed: true})
+    }
+    c.Session().Login(user, roles...)
+    return c.SeeOther(SafeReturnTo(returnTo, "/"))
+}
+
+// Logout destroys the session by POST, then redirects to the return_to
+// parameter.
+type Logout struct {
+    Ctx
+}
+
+func (c *Logout) Post() interface{} {
+    c.Session().Destroy()
+    return c.SeeOther(SafeReturnTo(c.Param(ReturnToParam), "/"))
+}
+
+// SafeReturnTo returns uri if it is a path on this site, or fallback if it may
+// lead to another site, like //evil.com or https://evil.com.
+func SafeReturnTo(uri string, fallback string) string {
+    if !strings.HasPrefix(uri, "/") || strings.HasPrefix(uri, "//") ||
+            strings.ContainsAny(uri, "\\\r\n\t") {
+        return fallback
+    }
+    u, err := url.Parse(uri)
+    if err != nil || u.Scheme != "" || u.Host != "" || u.User != nil || u.Opaque != "" {
+        return fallback
+    }
+    return uri
+}
+
+// loginRedirect returns the login page to redirect an unauthenticated request
+// to, with the page requested to return to if it is a GET.
+func (c *webApp) loginRedirect(r *http.Request) string {
+    loginURL := c.Settings["LOGIN_URL"]
+    if r.Method != "GET" && r.Method != "HEAD" {
+        return loginURL
+    }
+    sep := "?"
+    if strings.Contains(loginURL, "?") {
+        sep = "&"
+    }
+    return loginURL + sep + ReturnToParam + "=" + url.QueryEscape(r.URL.RequestURI())
+}
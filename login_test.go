@@ -0,0 +1,125 @@
+package vitali
+
+import (
+    "os"
+    "strings"
+    "testing"
+    "net/http"
+    "net/url"
+    "io/ioutil"
+    "path/filepath"
+    "net/http/httptest"
+)
+
+type LoginRequired struct {
+    Ctx
+    Perm `GET:"AUTHED"`
+    Provides `GET:"text/html,application/json"`
+    Views `GET:"username_test.html"`
+}
+
+func (c *LoginRequired) Get() interface{} {
+    return c.Username
+}
+
+func TestSafeReturnTo(t *testing.T) {
+    tests := map[string]string{
+        "/user/foo?a=b#c": "/user/foo?a=b#c",
+        "": "/",
+        "user/foo": "/",
+        "//evil.com/": "/",
+        "/\\evil.com": "/",
+        "https://evil.com/": "/",
+        "javascript:alert(1)": "/",
+        "/foo\r\nLocation: x": "/",
+    }
+    for uri, expected := range tests {
+        if SafeReturnTo(uri, "/") != expected {
+            t.Errorf("%s is returned as `%s`", uri, SafeReturnTo(uri, "/"))
+        }
+    }
+}
+
+func TestLoginFlow(t *testing.T) {
+    dir, _ := ioutil.TempDir("", "vitali-login-")
+    defer os.RemoveAll(dir)
+    passwdFile := filepath.Join(dir, "htpasswd")
+    groupFile := filepath.Join(dir, "htgroup")
+    ioutil.WriteFile(passwdFile, []byte(testHtpasswd), 0600)
+    ioutil.WriteFile(groupFile, []byte(testHtgroup), 0600)
+    checker, _ := CreateHtpasswdUserProvider("test", passwdFile, groupFile)
+
+    webapp := CreateWebApp([]RouteRule{
+        {"/login", Login{Checker: checker}},
+        {"/logout", Logout{}},
+        {"/private", LoginRequired{}},
+    })
+    webapp.Sessions = CreateSessionManager(CreateCookieStore("secret"))
+    webapp.UserProvider = &SessionUserProvider{webapp.Sessions}
+    webapp.Settings["LOGIN_URL"] = "/login"
+
+    serve := func(method string, uri string, accept string, form url.Values, cookie *http.Cookie) *httptest.ResponseRecorder {
+        u, _ := url.Parse(uri)
+        r := &http.Request{
+            Method: method,
+            Host:   "lunastorm.tw",
+            URL: u,
+            Form: form,
+            Header: make(http.Header),
+        }
+        r.Header.Set("Accept", accept)
+        if cookie != nil {
+            r.AddCookie(cookie)
+        }
+        rr := httptest.NewRecorder()
+        webapp.ServeHTTP(rr, r)
+        return rr
+    }
+
+    rr := serve("GET", "/private?a=b", "application/json", nil, nil)
+    if rr.Code != http.StatusUnauthorized {
+        t.Errorf("response code of json is %d", rr.Code)
+    }
+    rr = serve("GET", "/private?a=b", "text/html", nil, nil)
+    if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/login?return_to=%2Fprivate%3Fa%3Db" {
+        t.Errorf("response code is %d, location `%s`", rr.Code, rr.Header().Get("Location"))
+    }
+
+    rr = serve("GET", "/login?return_to=%2Fprivate%3Fa%3Db", "text/html", nil, nil)
+    if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `value="/private?a=b"`) {
+        t.Errorf("response code is %d, login page `%s`", rr.Code, rr.Body.String())
+    }
+    rr = serve("GET", "/login?return_to=%2F%2Fevil.com", "text/html", nil, nil)
+    if strings.Contains(rr.Body.String(), "evil.com") {
+        t.Errorf("login page returns to `%s`", rr.Body.String())
+    }
+
+    rr = serve("POST", "/login", "text/html", url.Values{"user": {"alice"}, "password": {"baz"},
+        "return_to": {"/private?a=b"}}, nil)
+    if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "Wrong user name or password") ||
+            len(rr.Result().Cookies()) != 0 {
+        t.Errorf("response code is %d, login page `%s`", rr.Code, rr.Body.String())
+    }
+
+    rr = serve("POST", "/login", "text/html", url.Values{"user": {"alice"}, "password": {"bar"},
+        "return_to": {"https://evil.com/"}}, nil)
+    if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/" {
+        t.Errorf("response code is %d, location `%s`", rr.Code, rr.Header().Get("Location"))
+    }
+    rr = serve("POST", "/login", "text/html", url.Values{"user": {"alice"}, "password": {"bar"},
+        "return_to": {"/private?a=b"}}, nil)
+    if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/private?a=b" {
+        t.Errorf("response code is %d, location `%s`", rr.Code, rr.Header().Get("Location"))
+    }
+    cookie := rr.Result().Cookies()[0]
+
+    rr = serve("GET", "/private?a=b", "text/html", nil, cookie)
+    if rr.Code != http.StatusOK || rr.Body.String() != "alice\n" {
+        t.Errorf("response code is %d, entity `%s`", rr.Code, rr.Body.String())
+    }
+
+    rr = serve("POST", "/logout", "text/html", url.Values{}, cookie)
+    if rr.Code != http.StatusSeeOther || rr.Result().Cookies()[0].MaxAge != -1 {
+        t.Errorf("response code is %d, cookie %v", rr.Code, rr.Result().Cookies())
+    }
+}
@@ -0,0 +1,238 @@
+package vitali
+
+import (
+    "io"
+    "fmt"
+    "sort"
+    "sync"
+    "time"
+    "bytes"
+    "strings"
+    "strconv"
+)
+
+// the default buckets of the request and template durations in seconds, and
+// of the response sizes in bytes
+var (
+    DefaultDurationBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+    DefaultSizeBuckets = []float64{100, 1000, 10000, 100000, 1e6, 1e7}
+)
+
+type histogram struct {
+    counts []uint64
+    sum float64
+    count uint64
+}
+
+func (c *histogram) observe(buckets []float64, v float64) {
+    if c.counts == nil {
+        c.counts = make([]uint64, len(buckets))
+    }
+    for i, bound := range buckets {
+        if v <= bound {
+            c.counts[i]++
+        }
+    }
+    c.sum += v
+    c.count++
+}
+
+type requestLabels struct {
+    route string
+    method string
+    status int
+}
+
+// Metrics records the requests handled by the webapps it is set to, labeled
+// by the route pattern, method and status, with the template render times
+// and the panics of the handlers. The metric names start with Namespace, and
+// the buckets default to DefaultDurationBuckets and DefaultSizeBuckets. The
+// settings are read when the first request is recorded.
+type Metrics struct {
+    Namespace string
+    DurationBuckets []float64
+    SizeBuckets []float64
+
+    mutex sync.Mutex
+    namespace string
+    durationBuckets []float64
+    sizeBuckets []float64
+    inFlight int64
+    requests map[requestLabels]uint64
+    durations map[requestLabels]*histogram
+    sizes map[requestLabels]*histogram
+    renders map[string]*histogram
+    panics map[string]uint64
+}
+
+func CreateMetrics() *Metrics {
+    return &Metrics{
+        Namespace: "vitali",
+        DurationBuckets: DefaultDurationBuckets,
+        SizeBuckets: DefaultSizeBuckets,
+    }
+}
+
+// init copies the settings and allocates the metrics on first use. The mutex
+// must be held.
+func (c *Metrics) init() {
+    if c.requests != nil {
+        return
+    }
+    c.namespace = c.Namespace
+    if c.namespace == "" {
+        c.namespace = "vitali"
+    }
+    c.durationBuckets = c.DurationBuckets
+    if len(c.durationBuckets) == 0 {
+        c.durationBuckets = DefaultDurationBuckets
+    }
+    c.durationBuckets = append([]float64{}, c.durationBuckets...)
+    c.sizeBuckets = c.SizeBuckets
+    if len(c.sizeBuckets) == 0 {
+        c.sizeBuckets = DefaultSizeBuckets
+    }
+    c.sizeBuckets = append([]float64{}, c.sizeBuckets...)
+    c.requests = make(map[requestLabels]uint64)
+    c.durations = make(map[requestLabels]*histogram)
+    c.sizes = make(map[requestLabels]*histogram)
+    c.renders = make(map[string]*histogram)
+    c.panics = make(map[string]uint64)
+}
+
+func (c *Metrics) begin() {
+    c.mutex.Lock()
+    c.init()
+    c.inFlight++
+    c.mutex.Unlock()
+}
+
+func (c *Metrics) end(route string, method string, status int, size int, elapsed time.Duration) {
+    labels := requestLabels{route, method, status}
+    c.mutex.Lock()
+    defer c.mutex.Unlock()
+    c.init()
+    c.inFlight--
+    c.requests[labels]++
+    if c.durations[labels] == nil {
+        c.durations[labels] = &histogram{}
+        c.sizes[labels] = &histogram{}
+    }
+    c.durations[labels].observe(c.durationBuckets, elapsed.Seconds())
+    c.sizes[labels].observe(c.sizeBuckets, float64(size))
+}
+
+func (c *Metrics) render(templateName string, elapsed time.Duration) {
+    c.mutex.Lock()
+    defer c.mutex.Unlock()
+    c.init()
+    if c.renders[templateName] == nil {
+        c.renders[templateName] = &histogram{}
+    }
+    c.renders[templateName].observe(c.durationBuckets, elapsed.Seconds())
+}
+
+func (c *Metrics) panicked(route string) {
+    c.mutex.Lock()
+    c.init()
+    c.panics[route]++
+    c.mutex.Unlock()
+}
+
+func labelValue(value string) string {
+    return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+func (c requestLabels) String() string {
+    return fmt.Sprintf(`route="%s",method="%s",status="%d"`, labelValue(c.route),
+        labelValue(c.method), c.status)
+}
+
+func formatFloat(v float64) string {
+    return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func (c *Metrics) writeHeader(w io.Writer, name string, kind string, help string) {
+    fmt.Fprintf(w, "# HELP %s_%s %s\n# TYPE %s_%s %s\n", c.namespace, name, help,
+        c.namespace, name, kind)
+}
+
+func (c *Metrics) writeHistogram(w io.Writer, name string, labels string, buckets []float64, h *histogram) {
+    for i, bound := range buckets {
+        fmt.Fprintf(w, "%s_%s_bucket{%s,le=\"%s\"} %d\n", c.namespace, name, labels,
+            formatFloat(bound), h.counts[i])
+    }
+    fmt.Fprintf(w, "%s_%s_bucket{%s,le=\"+Inf\"} %d\n", c.namespace, name, labels, h.count)
+    fmt.Fprintf(w, "%s_%s_sum{%s} %s\n", c.namespace, name, labels, formatFloat(h.sum))
+    fmt.Fprintf(w, "%s_%s_count{%s} %d\n", c.namespace, name, labels, h.count)
+}
+
+// WriteText writes the metrics in the Prometheus text exposition format.
+func (c *Metrics) WriteText(w io.Writer) error {
+    c.mutex.Lock()
+    defer c.mutex.Unlock()
+    c.init()
+
+    buf := &bytes.Buffer{}
+    labels := make([]requestLabels, 0, len(c.requests))
+    for l := range c.requests {
+        labels = append(labels, l)
+    }
+    sort.Slice(labels, func(i, j int) bool {
+        return labels[i].String() < labels[j].String()
+    })
+
+    c.writeHeader(buf, "requests_total", "counter", "Requests handled.")
+    for _, l := range labels {
+        fmt.Fprintf(buf, "%s_requests_total{%s} %d\n", c.namespace, l, c.requests[l])
+    }
+    c.writeHeader(buf, "requests_in_flight", "gauge", "Requests being handled.")
+    fmt.Fprintf(buf, "%s_requests_in_flight %d\n", c.namespace, c.inFlight)
+    c.writeHeader(buf, "request_duration_seconds", "histogram", "Time to handle the requests.")
+    for _, l := range labels {
+        c.writeHistogram(buf, "request_duration_seconds", l.String(), c.durationBuckets, c.durations[l])
+    }
+    c.writeHeader(buf, "response_size_bytes", "histogram", "Size of the response bodies.")
+    for _, l := range labels {
+        c.writeHistogram(buf, "response_size_bytes", l.String(), c.sizeBuckets, c.sizes[l])
+    }
+
+    templates := make([]string, 0, len(c.renders))
+    for t := range c.renders {
+        templates = append(templates, t)
+    }
+    sort.Strings(templates)
+    c.writeHeader(buf, "template_render_seconds", "histogram", "Time to render the views.")
+    for _, t := range templates {
+        c.writeHistogram(buf, "template_render_seconds", fmt.Sprintf(`template="%s"`, labelValue(t)),
+            c.durationBuckets, c.renders[t])
+    }
+
+    routes := make([]string, 0, len(c.panics))
+    for route := range c.panics {
+        routes = append(routes, route)
+    }
+    sort.Strings(routes)
+    c.writeHeader(buf, "panics_total", "counter", "Panics recovered from the handlers.")
+    for _, route := range routes {
+        fmt.Fprintf(buf, "%s_panics_total{route=\"%s\"} %d\n", c.namespace, labelValue(route),
+            c.panics[route])
+    }
+
+    _, err := w.Write(buf.Bytes())
+    return err
+}
+
+// MetricsResource is a resource exposing Metrics in the Prometheus text
+// format, e.g. {"/metrics", vitali.MetricsResource{Metrics: metrics}}.
+type MetricsResource struct {
+    Ctx
+    Metrics *Metrics
+}
+
+func (c *MetricsResource) Get() interface{} {
+    buf := &bytes.Buffer{}
+    c.Metrics.WriteText(buf)
+    c.ResponseWriter.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+    return buf.String()
+}
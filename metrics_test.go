@@ -0,0 +1,102 @@
+package vitali
+
+import (
+    "bytes"
+    "errors"
+    "testing"
+    "strings"
+    "net/http"
+    "net/http/httptest"
+)
+
+func TestMetrics(t *testing.T) {
+    metrics := CreateMetrics()
+    webapp := CreateWebApp([]RouteRule{
+        {"/metrics", MetricsResource{Metrics: metrics}},
+        {"/something/{id1}", Something{}},
+        {"/panic", Panikr{}},
+        {"/viewctx", ViewCtx{}},
+    })
+    webapp.Metrics = metrics
+    for _, r := range []*http.Request{
+        httptest.NewRequest("GET", "/something/foo", nil),
+        httptest.NewRequest("GET", "/something/bar", nil),
+        httptest.NewRequest("BREW", "/something/bar", nil),
+        httptest.NewRequest("GET", "/panic", nil),
+        httptest.NewRequest("GET", "/nothing", nil),
+        httptest.NewRequest("GET", "/viewctx", nil),
+    } {
+        webapp.ServeHTTP(httptest.NewRecorder(), r)
+    }
+
+    rr := httptest.NewRecorder()
+    webapp.ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+    if rr.Header().Get("Content-Type") != "text/plain; version=0.0.4; charset=utf-8" {
+        t.Errorf("content type is %s", rr.Header().Get("Content-Type"))
+    }
+    text := rr.Body.String()
+    for _, line := range []string{
+        "# TYPE vitali_requests_total counter",
+        `vitali_requests_total{route="/something/{id1}",method="GET",status="200"} 2`,
+        `vitali_requests_total{route="/something/{id1}",method="OTHER",status="405"} 1`,
+        `vitali_requests_total{route="",method="GET",status="404"} 1`,
+        `vitali_requests_total{route="/panic",method="GET",status="500"} 1`,
+        "vitali_requests_in_flight 1",
+        `vitali_request_duration_seconds_bucket{route="/something/{id1}",method="GET",status="200",le="+Inf"} 2`,
+        `vitali_request_duration_seconds_count{route="/something/{id1}",method="GET",status="200"} 2`,
+        `vitali_response_size_bytes_bucket{route="/something/{id1}",method="GET",status="200",le="100"} 2`,
+        `vitali_response_size_bytes_sum{route="/something/{id1}",method="GET",status="200"} 6`,
+        `vitali_template_render_seconds_count{template="ctx.html"} 1`,
+        `vitali_panics_total{route="/panic"} 1`,
+    } {
+        if !strings.Contains(text, line+"\n") {
+            t.Errorf("missing `%s` in\n%s", line, text)
+        }
+    }
+}
+
+type BadJSON struct{}
+
+func (c BadJSON) MarshalJSON() ([]byte, error) {
+    return nil, errors.New("bad json")
+}
+
+type MetricsPanic struct {
+    Ctx
+    Provides `GET:"application/json"`
+}
+
+func (c *MetricsPanic) Get() interface{} {
+    return BadJSON{}
+}
+
+func TestMetricsCreatedDirectly(t *testing.T) {
+    metrics := &Metrics{Namespace: "app", DurationBuckets: []float64{1}}
+    webapp := CreateWebApp([]RouteRule{
+        {"/something/{id1}", Something{}},
+        {"/escape", MetricsPanic{}},
+    })
+    webapp.Metrics = metrics
+    webapp.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/something/foo", nil))
+    metrics.DurationBuckets = append(metrics.DurationBuckets, 2, 3)
+    webapp.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/something/foo", nil))
+    func() {
+        defer func() {
+            recover()
+        }()
+        webapp.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/escape", nil))
+    }()
+
+    buf := &bytes.Buffer{}
+    metrics.WriteText(buf)
+    for _, line := range []string{
+        `app_requests_total{route="/something/{id1}",method="GET",status="200"} 2`,
+        `app_request_duration_seconds_bucket{route="/something/{id1}",method="GET",status="200",le="1"} 2`,
+        `app_response_size_bytes_bucket{route="/something/{id1}",method="GET",status="200",le="100"} 2`,
+        "app_requests_in_flight 0",
+    } {
+        if !strings.Contains(buf.String(), line+"\n") {
+            t.Errorf("missing `%s` in\n%s", line, buf.String())
+        }
+    }
+}
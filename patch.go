@@ -0,0 +1,391 @@
+package vitali
+
+import (
+    "fmt"
+    "bytes"
+    "errors"
+    "reflect"
+    "strconv"
+    "strings"
+    "math/big"
+    "net/http"
+    "io/ioutil"
+    "encoding/json"
+)
+
+const (
+    MergePatchType MediaType = "application/merge-patch+json"
+    JSONPatchType MediaType = "application/json-patch+json"
+)
+
+// ApplyPatch applies the JSON Merge Patch (RFC 7396) or JSON Patch (RFC 6902) in
+// the request body to model, which must be a pointer. The model is replaced
+// by the patched JSON document only if the whole patch is applied, keeping
+// the fields of a struct which are not in the document, like the unexported
+// ones and the ones tagged json:"-". The
+// errors carry 415 for other content types, 400 for a malformed patch, 409
+// for a failed test operation and 422 for a patch which cannot be applied.
+func (c *Ctx) ApplyPatch(model interface{}) error {
+    vModel := reflect.ValueOf(model)
+    if vModel.Kind() != reflect.Ptr || vModel.IsNil() {
+        panic("ApplyPatch needs a non-nil pointer to the model")
+    }
+    if c.ContentType != MergePatchType && c.ContentType != JSONPatchType {
+        return WithStatus(http.StatusUnsupportedMediaType,
+            fmt.Errorf("cannot patch by %s", c.ContentType))
+    }
+
+    body, err := ioutil.ReadAll(c.Request.Body)
+    if err != nil {
+        return WithStatus(http.StatusBadRequest, &DecodeError{c.ContentType, err})
+    }
+    doc := panicOnErr(decodeJSON(panicOnErr(json.Marshal(model)).([]byte)))
+
+    if c.ContentType == MergePatchType {
+        patch, err := decodeJSON(body)
+        if err != nil {
+            return WithStatus(http.StatusBadRequest, &DecodeError{c.ContentType, err})
+        }
+        doc = mergePatch(doc, patch)
+    } else {
+        var ops []jsonPatchOp
+        err = json.Unmarshal(body, &ops)
+        if err != nil {
+            return WithStatus(http.StatusBadRequest, &DecodeError{c.ContentType, err})
+        }
+        doc, err = applyJSONPatch(doc, ops)
+        if err != nil {
+            return err
+        }
+    }
+
+    patched := reflect.New(vModel.Elem().Type())
+    if vModel.Elem().Kind() == reflect.Struct {
+        patched.Elem().Set(vModel.Elem())
+        clearJSONFields(patched.Elem())
+    }
+    err = json.Unmarshal(panicOnErr(json.Marshal(doc)).([]byte), patched.Interface())
+    if err != nil {
+        return WithStatus(http.StatusUnprocessableEntity, err)
+    }
+    vModel.Elem().Set(patched.Elem())
+    return nil
+}
+
+// clearJSONFields zeroes the fields of the struct which are in its JSON
+// document, so that the fields removed by the patch are not kept.
+func clearJSONFields(v reflect.Value) {
+    t := v.Type()
+    for i := 0; i < t.NumField(); i++ {
+        field := t.Field(i)
+        tag := field.Tag.Get("json")
+        if tag == "-" {
+            continue
+        }
+        if field.Anonymous && field.Type.Kind() == reflect.Struct &&
+                strings.Split(tag, ",")[0] == "" {
+            // the fields are promoted to the document
+            clearJSONFields(v.Field(i))
+            continue
+        }
+        if field.PkgPath != "" {
+            continue
+        }
+        v.Field(i).Set(reflect.Zero(field.Type))
+    }
+}
+
+func decodeJSON(content []byte) (v interface{}, err error) {
+    decoder := json.NewDecoder(bytes.NewReader(content))
+    decoder.UseNumber()
+    err = decoder.Decode(&v)
+    return
+}
+
+func mergePatch(target interface{}, patch interface{}) interface{} {
+    members, ok := patch.(map[string]interface{})
+    if !ok {
+        return patch
+    }
+    object, ok := target.(map[string]interface{})
+    if !ok {
+        object = make(map[string]interface{})
+    }
+    for name, value := range members {
+        if value == nil {
+            delete(object, name)
+        } else {
+            object[name] = mergePatch(object[name], value)
+        }
+    }
+    return object
+}
+
+type jsonPatchOp struct {
+    Op string `json:"op"`
+    Path *string `json:"path"`
+    From *string `json:"from"`
+    Value json.RawMessage `json:"value"`
+}
+
+var errTestFailed = errors.New("test failed")
+
+func applyJSONPatch(doc interface{}, ops []jsonPatchOp) (interface{}, error) {
+    for i, op := range ops {
+        var err error
+        doc, err = op.apply(doc)
+        if err != nil {
+            code := http.StatusUnprocessableEntity
+            if err == errTestFailed {
+                code = http.StatusConflict
+            }
+            var de *DecodeError
+            if errors.As(err, &de) {
+                code = http.StatusBadRequest
+            }
+            return nil, WithStatus(code, fmt.Errorf("operation %d %s: %w", i, op.Op, err))
+        }
+    }
+    return doc, nil
+}
+
+func (c jsonPatchOp) apply(doc interface{}) (interface{}, error) {
+    if c.Path == nil {
+        return nil, &DecodeError{JSONPatchType, errors.New("missing path")}
+    }
+    path, err := splitPointer(*c.Path)
+    if err != nil {
+        return nil, err
+    }
+    var value interface{}
+    switch c.Op {
+    case "add", "replace", "test":
+        if c.Value == nil {
+            return nil, &DecodeError{JSONPatchType, errors.New("missing value")}
+        }
+        value, err = decodeJSON(c.Value)
+        if err != nil {
+            return nil, &DecodeError{JSONPatchType, err}
+        }
+    case "move", "copy":
+        if c.From == nil {
+            return nil, &DecodeError{JSONPatchType, errors.New("missing from")}
+        }
+        from, err := splitPointer(*c.From)
+        if err != nil {
+            return nil, err
+        }
+        if c.Op == "move" {
+            if strings.HasPrefix(*c.Path+"/", *c.From+"/") && *c.Path != *c.From {
+                return nil, errors.New("cannot move into itself")
+            }
+            doc, value, err = pointerRemove(doc, from)
+        } else {
+            value, err = pointerGet(doc, from)
+            if err == nil {
+                // copy the value so that the copies are not shared
+                value, err = decodeJSON(panicOnErr(json.Marshal(value)).([]byte))
+            }
+        }
+        if err != nil {
+            return nil, err
+        }
+    case "remove":
+    default:
+        return nil, &DecodeError{JSONPatchType, fmt.Errorf("unknown op %q", c.Op)}
+    }
+
+    switch c.Op {
+    case "remove":
+        doc, _, err = pointerRemove(doc, path)
+    case "replace":
+        if len(path) == 0 {
+            // the whole document is replaced
+            return value, nil
+        }
+        doc, _, err = pointerRemove(doc, path)
+        if err == nil {
+            doc, err = pointerAdd(doc, path, value)
+        }
+    case "test":
+        var current interface{}
+        current, err = pointerGet(doc, path)
+        if err == nil && !jsonEqual(current, value) {
+            err = errTestFailed
+        }
+    default:
+        doc, err = pointerAdd(doc, path, value)
+    }
+    return doc, err
+}
+
+// jsonEqual compares the decoded JSON values as the test op does, where the
+// numbers are equal by value, e.g. 1 and 1.0.
+func jsonEqual(a interface{}, b interface{}) bool {
+    switch a := a.(type) {
+    case json.Number:
+        b, ok := b.(json.Number)
+        if !ok {
+            return false
+        }
+        x, _, errA := big.ParseFloat(string(a), 10, 256, big.ToNearestEven)
+        y, _, errB := big.ParseFloat(string(b), 10, 256, big.ToNearestEven)
+        if errA != nil || errB != nil {
+            return a == b
+        }
+        return x.Cmp(y) == 0
+    case map[string]interface{}:
+        b, ok := b.(map[string]interface{})
+        if !ok || len(a) != len(b) {
+            return false
+        }
+        for k, v := range a {
+            w, ok := b[k]
+            if !ok || !jsonEqual(v, w) {
+                return false
+            }
+        }
+        return true
+    case []interface{}:
+        b, ok := b.([]interface{})
+        if !ok || len(a) != len(b) {
+            return false
+        }
+        for i := range a {
+            if !jsonEqual(a[i], b[i]) {
+                return false
+            }
+        }
+        return true
+    }
+    return reflect.DeepEqual(a, b)
+}
+
+// splitPointer returns the reference tokens of a JSON pointer (RFC 6901).
+func splitPointer(pointer string) ([]string, error) {
+    if pointer == "" {
+        return []string{}, nil
+    }
+    if pointer[0] != '/' {
+        return nil, &DecodeError{JSONPatchType, fmt.Errorf("invalid pointer %q", pointer)}
+    }
+    tokens := strings.Split(pointer[1:], "/")
+    for i, token := range tokens {
+        tokens[i] = strings.Replace(strings.Replace(token, "~1", "/", -1), "~0", "~", -1)
+    }
+    return tokens, nil
+}
+
+// arrayIndex returns the index of an array for the token, which may be the
+// length of the array if end is true.
+func arrayIndex(array []interface{}, token string, end bool) (int, error) {
+    if end && token == "-" {
+        return len(array), nil
+    }
+    i, err := strconv.Atoi(token)
+    if err != nil || i < 0 || (len(token) > 1 && token[0] == '0') {
+        return 0, fmt.Errorf("invalid array index %q", token)
+    }
+    if i > len(array) || (i == len(array) && !end) {
+        return 0, fmt.Errorf("array index %d out of range", i)
+    }
+    return i, nil
+}
+
+func pointerGet(doc interface{}, path []string) (interface{}, error) {
+    for _, token := range path {
+        switch v := doc.(type) {
+        case map[string]interface{}:
+            member, ok := v[token]
+            if !ok {
+                return nil, fmt.Errorf("member %q not found", token)
+            }
+            doc = member
+        case []interface{}:
+            i, err := arrayIndex(v, token, false)
+            if err != nil {
+                return nil, err
+            }
+            doc = v[i]
+        default:
+            return nil, fmt.Errorf("%q is not in a container", token)
+        }
+    }
+    return doc, nil
+}
+
+// pointerUpdate calls update with the container of the value referenced by
+// path, and returns doc with the container replaced by the one returned.
+func pointerUpdate(doc interface{}, path []string,
+        update func(container interface{}, token string) (interface{}, error)) (interface{}, error) {
+    if len(path) == 1 {
+        return update(doc, path[0])
+    }
+    child, err := pointerGet(doc, path[:1])
+    if err != nil {
+        return nil, err
+    }
+    child, err = pointerUpdate(child, path[1:], update)
+    if err != nil {
+        return nil, err
+    }
+    switch v := doc.(type) {
+    case map[string]interface{}:
+        v[path[0]] = child
+    case []interface{}:
+        i, _ := arrayIndex(v, path[0], false)
+        v[i] = child
+    }
+    return doc, nil
+}
+
+func pointerAdd(doc interface{}, path []string, value interface{}) (interface{}, error) {
+    if len(path) == 0 {
+        return value, nil
+    }
+    return pointerUpdate(doc, path, func(container interface{}, token string) (interface{}, error) {
+        switch v := container.(type) {
+        case map[string]interface{}:
+            v[token] = value
+            return v, nil
+        case []interface{}:
+            i, err := arrayIndex(v, token, true)
+            if err != nil {
+                return nil, err
+            }
+            v = append(v, nil)
+            copy(v[i+1:], v[i:])
+            v[i] = value
+            return v, nil
+        }
+        return nil, fmt.Errorf("%q is not in a container", token)
+    })
+}
+
+func pointerRemove(doc interface{}, path []string) (interface{}, interface{}, error) {
+    if len(path) == 0 {
+        return nil, nil, errors.New("cannot remove the whole document")
+    }
+    var removed interface{}
+    doc, err := pointerUpdate(doc, path, func(container interface{}, token string) (interface{}, error) {
+        switch v := container.(type) {
+        case map[string]interface{}:
+            member, ok := v[token]
+            if !ok {
+                return nil, fmt.Errorf("member %q not found", token)
+            }
+            removed = member
+            delete(v, token)
+            return v, nil
+        case []interface{}:
+            i, err := arrayIndex(v, token, false)
+            if err != nil {
+                return nil, err
+            }
+            removed = v[i]
+            return append(v[:i], v[i+1:]...), nil
+        }
+        return nil, fmt.Errorf("%q is not in a container", token)
+    })
+    return doc, removed, err
+}
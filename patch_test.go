@@ -0,0 +1,133 @@
+package vitali
+
+import (
+    "errors"
+    "testing"
+    "strings"
+    "net/http"
+    "net/http/httptest"
+)
+
+type PatchModel struct {
+    Name string `json:"name"`
+    Tags []string `json:"tags"`
+    Owner *PatchOwner `json:"owner,omitempty"`
+    Version int `json:"-"`
+    loaded bool
+}
+
+type PatchOwner struct {
+    Id int64 `json:"id"`
+}
+
+type PatchTest struct {
+    Ctx
+    Provides `PATCH:"application/json"`
+}
+
+func (c *PatchTest) Patch() (*PatchModel, error) {
+    model := &PatchModel{
+        Name: "foo",
+        Tags: []string{"a", "b"},
+        Owner: &PatchOwner{9007199254740993},
+        Version: 3,
+        loaded: true,
+    }
+    if err := c.ApplyPatch(model); err != nil {
+        return nil, err
+    }
+    if model.Version != 3 || !model.loaded {
+        return nil, errors.New("the fields not in the document are lost")
+    }
+    return model, nil
+}
+
+func (c *PatchTest) MakeCollection() error {
+    return nil
+}
+
+func (c *PatchTest) Mkcol() error {
+    return nil
+}
+
+func TestPatch(t *testing.T) {
+    webapp := CreateWebApp([]RouteRule{
+        {"/patch", PatchTest{}},
+    })
+    tests := []struct {
+        contentType MediaType
+        body string
+        code int
+        model string
+    }{
+        {MergePatchType, `{"name":"bar","owner":null}`, http.StatusOK,
+            `{"name":"bar","tags":["a","b"]}`},
+        {MergePatchType, `{"tags":["c"],"owner":{"id":2}}`, http.StatusOK,
+            `{"name":"foo","tags":["c"],"owner":{"id":2}}`},
+        {JSONPatchType, `[{"op":"test","path":"/owner/id","value":9007199254740993},
+            {"op":"add","path":"/tags/1","value":"x"},{"op":"remove","path":"/tags/0"},
+            {"op":"copy","from":"/tags/0","path":"/tags/-"},{"op":"move","from":"/tags/1","path":"/name"}]`,
+            http.StatusOK, `{"name":"b","tags":["x","x"],"owner":{"id":9007199254740993}}`},
+        {JSONPatchType, `[{"op":"replace","path":"/name","value":"bar"},{"op":"test","path":"/name","value":"foo"}]`,
+            http.StatusConflict, ""},
+        {JSONPatchType, `[{"op":"test","path":"/owner","value":{"id":9.007199254740993e15}},
+            {"op":"test","path":"/tags","value":["a","b"]}]`,
+            http.StatusOK, `{"name":"foo","tags":["a","b"],"owner":{"id":9007199254740993}}`},
+        {JSONPatchType, `[{"op":"test","path":"/owner/id","value":9007199254740992}]`,
+            http.StatusConflict, ""},
+        {JSONPatchType, `[{"op":"test","path":"/owner/id","value":"9007199254740993"}]`,
+            http.StatusConflict, ""},
+        {JSONPatchType, `[{"op":"replace","path":"","value":{"name":"root"}}]`,
+            http.StatusOK, `{"name":"root","tags":null}`},
+        {JSONPatchType, `[{"op":"remove","path":"/owner"}]`,
+            http.StatusOK, `{"name":"foo","tags":["a","b"]}`},
+        {JSONPatchType, `[{"op":"remove","path":"/tags/5"}]`, http.StatusUnprocessableEntity, ""},
+        {JSONPatchType, `[{"op":"replace","path":"/name","value":1}]`, http.StatusUnprocessableEntity, ""},
+        {JSONPatchType, `[{"op":"jump","path":"/name"}]`, http.StatusBadRequest, ""},
+        {MergePatchType, `{"name":`, http.StatusBadRequest, ""},
+        {"application/json", `{"name":"bar"}`, http.StatusUnsupportedMediaType, ""},
+    }
+    for _, test := range tests {
+        r := httptest.NewRequest("PATCH", "/patch", strings.NewReader(test.body))
+        r.Header.Set("Content-Type", string(test.contentType))
+        rr := httptest.NewRecorder()
+        webapp.ServeHTTP(rr, r)
+        if rr.Code != test.code {
+            t.Errorf("%s: response code is %d", test.body, rr.Code)
+        }
+        if test.model == "" {
+            continue
+        }
+        if rr.Body.String() != test.model {
+            t.Errorf("%s: entity is `%s`", test.body, rr.Body.String())
+        }
+    }
+}
+
+func TestCustomMethods(t *testing.T) {
+    webapp := CreateWebApp([]RouteRule{
+        {"/patch", PatchTest{}},
+    })
+    webapp.Methods["MKCOL"] = "MakeCollection"
+    webapp.Methods["VERSION-CONTROL"] = "Mkcol"
+
+    for _, method := range []string{"MKCOL", "VERSION-CONTROL"} {
+        r := httptest.NewRequest(method, "/patch", nil)
+        rr := httptest.NewRecorder()
+        webapp.ServeHTTP(rr, r)
+        if rr.Code != http.StatusNoContent {
+            t.Errorf("%s: response code is %d", method, rr.Code)
+        }
+    }
+
+    r := httptest.NewRequest("GET", "/patch", nil)
+    rr := httptest.NewRecorder()
+    webapp.ServeHTTP(rr, r)
+    if rr.Code != http.StatusMethodNotAllowed {
+        t.Errorf("response code is %d", rr.Code)
+    }
+    allowed := rr.Header().Get("Allow")
+    if allowed != "MKCOL, VERSION-CONTROL, PATCH" {
+        t.Errorf("allow header is %s", allowed)
+    }
+}
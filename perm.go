@@ -0,0 +1,250 @@
+package vitali
+
+import (
+    "fmt"
+    "errors"
+    "strconv"
+    "strings"
+    "reflect"
+)
+
+// permExpr is a parsed vitali.Perm tag value like "ADMIN|(EDITOR&!BANNED)".
+type permExpr interface {
+    eval(ctx *Ctx) bool
+}
+
+type permRole string
+type permPolicy struct {
+    name string
+    args []string
+}
+type permNot struct{ x permExpr }
+type permAnd struct{ x, y permExpr }
+type permOr struct{ x, y permExpr }
+
+func (c permRole) eval(ctx *Ctx) bool {
+    return ctx.Roles.Exist(string(c))
+}
+
+func (c permPolicy) eval(ctx *Ctx) bool {
+    policy, ok := ctx.app.Policies[c.name]
+    if !ok {
+        ctx.logger().Log(LevelError, "unknown policy", "policy", c.name)
+        return false
+    }
+    return policy.Allow(ctx, Method(ctx.Request.Method), ctx.pathParams, c.args...)
+}
+
+func (c permNot) eval(ctx *Ctx) bool {
+    return !c.x.eval(ctx)
+}
+
+func (c permAnd) eval(ctx *Ctx) bool {
+    return c.x.eval(ctx) && c.y.eval(ctx)
+}
+
+func (c permOr) eval(ctx *Ctx) bool {
+    return c.x.eval(ctx) || c.y.eval(ctx)
+}
+
+type permParser struct {
+    s string
+    pos int
+}
+
+func parsePerm(s string) (permExpr, error) {
+    p := &permParser{s: s}
+    x, err := p.parseOr()
+    if err != nil {
+        return nil, err
+    }
+    p.skipSpaces()
+    if p.pos < len(p.s) {
+        return nil, p.errorf("unexpected %q", p.s[p.pos])
+    }
+    return x, nil
+}
+
+func (c *permParser) errorf(format string, args ...interface{}) error {
+    return fmt.Errorf("%s at %d in %q", fmt.Sprintf(format, args...), c.pos, c.s)
+}
+
+func (c *permParser) skipSpaces() {
+    for c.pos < len(c.s) && c.s[c.pos] == ' ' {
+        c.pos++
+    }
+}
+
+func (c *permParser) consume(op byte) bool {
+    c.skipSpaces()
+    if c.pos < len(c.s) && c.s[c.pos] == op {
+        c.pos++
+        return true
+    }
+    return false
+}
+
+func (c *permParser) parseOr() (permExpr, error) {
+    x, err := c.parseAnd()
+    for err == nil && c.consume('|') {
+        var y permExpr
+        y, err = c.parseAnd()
+        x = permOr{x, y}
+    }
+    return x, err
+}
+
+func (c *permParser) parseAnd() (permExpr, error) {
+    x, err := c.parseUnary()
+    for err == nil && c.consume('&') {
+        var y permExpr
+        y, err = c.parseUnary()
+        x = permAnd{x, y}
+    }
+    return x, err
+}
+
+func (c *permParser) parseUnary() (permExpr, error) {
+    if c.consume('!') {
+        x, err := c.parseUnary()
+        return permNot{x}, err
+    }
+    if c.consume('(') {
+        x, err := c.parseOr()
+        if err != nil {
+            return nil, err
+        }
+        if !c.consume(')') {
+            return nil, c.errorf("missing )")
+        }
+        return x, nil
+    }
+    start := c.pos
+    for c.pos < len(c.s) && !strings.ContainsRune(" !&|()", rune(c.s[c.pos])) {
+        c.pos++
+    }
+    if start == c.pos {
+        if c.pos == len(c.s) {
+            return nil, c.errorf("missing role")
+        }
+        return nil, c.errorf("unexpected %q", c.s[c.pos])
+    }
+    name := c.s[start:c.pos]
+    if !strings.HasPrefix(name, "policy:") {
+        return permRole(name), nil
+    }
+    return c.parsePolicy(name[len("policy:"):])
+}
+
+// parsePolicy parses the optional arguments of a policy like
+// "policy:ownerOf(user)".
+func (c *permParser) parsePolicy(name string) (permExpr, error) {
+    if name == "" {
+        return nil, c.errorf("missing policy name")
+    }
+    policy := permPolicy{name: name}
+    if c.pos == len(c.s) || c.s[c.pos] != '(' {
+        return policy, nil
+    }
+    c.pos++
+    end := strings.IndexByte(c.s[c.pos:], ')')
+    if end < 0 {
+        return nil, c.errorf("missing )")
+    }
+    args := strings.TrimSpace(c.s[c.pos:c.pos+end])
+    c.pos += end + 1
+    if args == "" {
+        return policy, nil
+    }
+    for _, arg := range strings.Split(args, ",") {
+        arg = strings.TrimSpace(arg)
+        if arg == "" || strings.ContainsAny(arg, " !&|(") {
+            return nil, c.errorf("invalid argument %q of policy %s", arg, name)
+        }
+        policy.args = append(policy.args, arg)
+    }
+    return policy, nil
+}
+
+// tagValues returns the key:"value" pairs of a struct tag in order.
+func tagValues(tag reflect.StructTag) ([][2]string, error) {
+    pairs := [][2]string{}
+    s := strings.TrimSpace(string(tag))
+    for s != "" {
+        i := strings.Index(s, ":")
+        if i <= 0 || strings.ContainsAny(s[:i], " \"") {
+            return nil, errors.New("malformed tag " + strconv.Quote(string(tag)))
+        }
+        value, err := strconv.QuotedPrefix(s[i+1:])
+        if err != nil {
+            return nil, errors.New("malformed tag " + strconv.Quote(string(tag)))
+        }
+        unquoted, _ := strconv.Unquote(value)
+        pairs = append(pairs, [2]string{s[:i], unquoted})
+        s = strings.TrimSpace(s[i+1+len(value):])
+    }
+    return pairs, nil
+}
+
+// parsePermTag parses all the expressions of a vitali.Perm tag into perms.
+func parsePermTag(tag reflect.StructTag, perms map[string]permExpr) error {
+    pairs, err := tagValues(tag)
+    if err != nil {
+        return err
+    }
+    for _, kv := range pairs {
+        if _, ok := perms[kv[1]]; ok {
+            continue
+        }
+        x, err := parsePerm(kv[1])
+        if err != nil {
+            return fmt.Errorf("%s: %s", kv[0], err)
+        }
+        perms[kv[1]] = x
+    }
+    return nil
+}
+
+// impliedRoles adds the roles implied by RoleHierarchy to roles.
+func (c *webApp) impliedRoles(roles Roles) {
+    pending := make([]string, 0, len(roles))
+    for role := range roles {
+        pending = append(pending, role)
+    }
+    for len(pending) > 0 {
+        role := pending[len(pending)-1]
+        pending = pending[:len(pending)-1]
+        for _, implied := range c.RoleHierarchy[role] {
+            if !roles.Exist(implied) {
+                roles.Add(implied)
+                pending = append(pending, implied)
+            }
+        }
+    }
+}
+
+// tagValue returns the value of the method in a tag, or the "*" one.
+func tagValue(tag reflect.StructTag, method string) string {
+    value := tag.Get(method)
+    if value == "" {
+        value = tag.Get("*")
+    }
+    return value
+}
+
+func (c *webApp) checkPermission(perm reflect.StructTag, method Method, ctx *Ctx) bool {
+    required := tagValue(perm, string(method))
+    if required == "" {
+        return true
+    }
+    x, ok := c.perms[required]
+    if !ok {
+        var err error
+        x, err = parsePerm(required)
+        if err != nil {
+            return false
+        }
+    }
+    c.impliedRoles(ctx.Roles)
+    return x.eval(ctx)
+}
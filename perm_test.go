@@ -0,0 +1,185 @@
+package vitali
+
+import (
+    "strings"
+    "testing"
+    "net/http"
+    "net/url"
+    "net/http/httptest"
+)
+
+func TestParsePerm(t *testing.T) {
+    roles := Roles{"EDITOR": struct{}{}, "BANNED": struct{}{}}
+    tests := []struct {
+        expr string
+        result bool
+    }{
+        {"EDITOR", true},
+        {"ADMIN", false},
+        {"ADMIN|EDITOR", true},
+        {"ADMIN | EDITOR", true},
+        {"EDITOR&BANNED", true},
+        {"EDITOR&!BANNED", false},
+        {"!!EDITOR", true},
+        {"ADMIN|EDITOR&!BANNED", false},
+        {"(ADMIN|EDITOR)&BANNED", true},
+        {"!(ADMIN|OWNER)", true},
+        {"_AUTHED|EDITOR", true},
+    }
+    for _, test := range tests {
+        x, err := parsePerm(test.expr)
+        if err != nil {
+            t.Errorf("%s: %s", test.expr, err)
+            continue
+        }
+        if x.eval(&Ctx{Roles: roles}) != test.result {
+            t.Errorf("%s is %v", test.expr, !test.result)
+        }
+    }
+
+    for _, expr := range []string{"", "ADMIN|", "&ADMIN", "(ADMIN", "ADMIN)", "ADMIN EDITOR", "!"} {
+        _, err := parsePerm(expr)
+        if err == nil {
+            t.Errorf("%q is parsed", expr)
+        }
+    }
+}
+
+type PermTest struct {
+    Ctx
+    Perm `GET:"EDITOR & !BANNED" DELETE:"ADMIN"`
+}
+
+func (c PermTest) Get() interface{} {
+    return "ok"
+}
+
+func (c PermTest) Delete() interface{} {
+    return "deleted"
+}
+
+type rolesProvider []string
+
+func (c rolesProvider) GetUserAndRoles(r *http.Request) (string, []string) {
+    return "bob", c
+}
+
+func (c rolesProvider) AuthHeader(r *http.Request) string {
+    return ""
+}
+
+func TestRoleHierarchy(t *testing.T) {
+    webapp := CreateWebApp([]RouteRule{
+        {"/perm", PermTest{}},
+    })
+    webapp.RoleHierarchy = map[string][]string{
+        "ADMIN": {"EDITOR"},
+        "EDITOR": {"AUTHED"},
+        "AUTHED": {"ADMIN"},
+    }
+
+    tests := []struct {
+        roles []string
+        method string
+        code int
+    }{
+        {[]string{"EDITOR"}, "GET", http.StatusOK},
+        {[]string{"ADMIN"}, "GET", http.StatusOK},
+        {[]string{"ADMIN", "BANNED"}, "GET", http.StatusForbidden},
+        {[]string{"AUTHED"}, "DELETE", http.StatusOK},
+        {[]string{"OTHER"}, "DELETE", http.StatusForbidden},
+    }
+    for _, test := range tests {
+        webapp.UserProvider = rolesProvider(test.roles)
+        r := &http.Request{
+            Method: test.method,
+            URL: &url.URL{
+                Path: "/perm",
+            },
+        }
+        rr := httptest.NewRecorder()
+        webapp.ServeHTTP(rr, r)
+        if rr.Code != test.code {
+            t.Errorf("%s by %v is %d", test.method, test.roles, rr.Code)
+        }
+    }
+}
+
+type InvalidPermTest struct {
+    Ctx
+    Perm `GET:"ADMIN &"`
+}
+
+func TestInvalidPermTag(t *testing.T) {
+    defer func() {
+        r := recover()
+        if r == nil || !strings.Contains(r.(string), "/invalid") {
+            t.Errorf("recovered %v", r)
+        }
+    }()
+    CreateWebApp([]RouteRule{
+        {"/invalid", InvalidPermTest{}},
+    })
+}
+
+type PolicyTest struct {
+    Ctx
+    Perm `GET:"policy:ownerOf(user) | ADMIN" DELETE:"policy:ownerOf(user) & policy:weekday"`
+}
+
+func (c PolicyTest) Get() interface{} {
+    return "ok"
+}
+
+func (c PolicyTest) Delete() interface{} {
+    return "deleted"
+}
+
+func TestPolicy(t *testing.T) {
+    webapp := CreateWebApp([]RouteRule{
+        {"/user/{user}", PolicyTest{}},
+    })
+    weekday := false
+    webapp.Policies["weekday"] = PolicyFunc(func(ctx *Ctx, method Method, pathParams map[string]string, args ...string) bool {
+        if method != "DELETE" || pathParams["user"] != "bob" || len(args) != 0 {
+            t.Errorf("policy called with %s %v %v", method, pathParams, args)
+        }
+        return weekday
+    })
+
+    tests := []struct {
+        roles []string
+        method string
+        path string
+        weekday bool
+        code int
+    }{
+        {[]string{}, "GET", "/user/bob", false, http.StatusOK},
+        {[]string{}, "GET", "/user/alice", false, http.StatusForbidden},
+        {[]string{"ADMIN"}, "GET", "/user/alice", false, http.StatusOK},
+        {[]string{}, "DELETE", "/user/bob", true, http.StatusOK},
+        {[]string{}, "DELETE", "/user/bob", false, http.StatusForbidden},
+    }
+    for _, test := range tests {
+        webapp.UserProvider = rolesProvider(test.roles)
+        weekday = test.weekday
+        r := &http.Request{
+            Method: test.method,
+            URL: &url.URL{
+                Path: test.path,
+            },
+        }
+        rr := httptest.NewRecorder()
+        webapp.ServeHTTP(rr, r)
+        if rr.Code != test.code {
+            t.Errorf("%s %s by %v is %d", test.method, test.path, test.roles, rr.Code)
+        }
+    }
+
+    for _, expr := range []string{"policy:", "policy:ownerOf(user", "policy:ownerOf(a b)"} {
+        _, err := parsePerm(expr)
+        if err == nil {
+            t.Errorf("%q is parsed", expr)
+        }
+    }
+}
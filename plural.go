@@ -0,0 +1,121 @@
+package vitali
+
+import (
+    "fmt"
+    "strconv"
+    "strings"
+)
+
+// pluralOperand turns a plural argument into its decimal representation,
+// keeping the visible fraction digits which matter to the plural rules.
+func pluralOperand(v interface{}) (string, error) {
+    switch n := v.(type) {
+    case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+        return fmt.Sprint(n), nil
+    case float32:
+        return strconv.FormatFloat(float64(n), 'f', -1, 32), nil
+    case float64:
+        return strconv.FormatFloat(n, 'f', -1, 64), nil
+    case string:
+        if _, err := strconv.ParseFloat(n, 64); err != nil {
+            return "", fmt.Errorf("%s is not a number", n)
+        }
+        return n, nil
+    }
+    return "", fmt.Errorf("%v is not a number", v)
+}
+
+// pluralCategory returns the CLDR plural category (zero, one, two, few, many
+// or other) of the number num in lang.
+func pluralCategory(lang string, num string) string {
+    num = strings.TrimPrefix(num, "-")
+    intPart, fracPart := num, ""
+    if i := strings.Index(num, "."); i >= 0 {
+        intPart, fracPart = num[:i], num[i+1:]
+    }
+    n, _ := strconv.ParseFloat(num, 64)
+    i, _ := strconv.ParseInt(intPart, 10, 64)
+    v := len(fracPart)
+    isInt := v == 0 || strings.Trim(fracPart, "0") == ""
+
+    inRange := func(x int64, from int64, to int64) bool {
+        return x >= from && x <= to
+    }
+
+    lang = strings.ToLower(lang)
+    if j := strings.Index(lang, "-"); j >= 0 {
+        lang = lang[:j]
+    }
+    switch lang {
+    case "zh", "ja", "ko", "th", "vi", "id", "ms", "lo", "my", "km":
+        return "other"
+    case "fr", "pt":
+        if i == 0 || i == 1 {
+            return "one"
+        }
+    case "es", "el", "hu", "tr", "bg", "az", "ka", "kk", "uz":
+        if n == 1 {
+            return "one"
+        }
+    case "ru", "uk", "be":
+        if v != 0 {
+            return "other"
+        }
+        switch {
+        case i%10 == 1 && i%100 != 11:
+            return "one"
+        case inRange(i%10, 2, 4) && !inRange(i%100, 12, 14):
+            return "few"
+        default:
+            return "many"
+        }
+    case "pl":
+        if v != 0 {
+            return "other"
+        }
+        switch {
+        case i == 1:
+            return "one"
+        case inRange(i%10, 2, 4) && !inRange(i%100, 12, 14):
+            return "few"
+        default:
+            return "many"
+        }
+    case "cs", "sk":
+        switch {
+        case v != 0:
+            return "many"
+        case i == 1:
+            return "one"
+        case inRange(i, 2, 4):
+            return "few"
+        }
+    case "ar":
+        if !isInt {
+            return "other"
+        }
+        switch {
+        case i == 0:
+            return "zero"
+        case i == 1:
+            return "one"
+        case i == 2:
+            return "two"
+        case inRange(i%100, 3, 10):
+            return "few"
+        case inRange(i%100, 11, 99):
+            return "many"
+        }
+    case "he":
+        if v == 0 && i == 1 {
+            return "one"
+        } else if v == 0 && i == 2 {
+            return "two"
+        }
+    default:
+        if i == 1 && v == 0 {
+            return "one"
+        }
+    }
+    return "other"
+}
@@ -0,0 +1,26 @@
+package vitali
+
+// Policy decides whether a request is allowed beyond the roles, like whether
+// the user owns the resource. A policy is registered in webApp.Policies by
+// name, and referenced in the vitali.Perm tags as "policy:name" or
+// "policy:name(arg1,arg2)", where the args are passed as they are written.
+// Policies are evaluated after Pre(), so they see the roles added there.
+type Policy interface {
+    Allow(ctx *Ctx, method Method, pathParams map[string]string, args ...string) bool
+}
+
+type PolicyFunc func(ctx *Ctx, method Method, pathParams map[string]string, args ...string) bool
+
+func (c PolicyFunc) Allow(ctx *Ctx, method Method, pathParams map[string]string, args ...string) bool {
+    return c(ctx, method, pathParams, args...)
+}
+
+// OwnerOf allows the user named by the path param of the first argument, for
+// example "policy:ownerOf(user)" on /user/{user}/slide. It is registered as
+// ownerOf by default.
+var OwnerOf = PolicyFunc(func(ctx *Ctx, method Method, pathParams map[string]string, args ...string) bool {
+    if len(args) != 1 || ctx.Username == "" {
+        return false
+    }
+    return pathParams[args[0]] == ctx.Username
+})
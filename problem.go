@@ -0,0 +1,191 @@
+package vitali
+
+import (
+    "fmt"
+    "sort"
+    "strings"
+    "net/http"
+    "encoding/xml"
+    "encoding/json"
+)
+
+// Problem is an RFC 7807 problem details object. The Extensions are
+// marshaled as members next to the standard ones.
+type Problem struct {
+    Type string
+    Title string
+    Status int
+    Detail string
+    Instance string
+    Extensions map[string]interface{}
+}
+
+func (c Problem) members() map[string]interface{} {
+    m := make(map[string]interface{})
+    for k, v := range c.Extensions {
+        m[k] = v
+    }
+    m["type"] = c.Type
+    m["title"] = c.Title
+    m["status"] = c.Status
+    if c.Detail != "" {
+        m["detail"] = c.Detail
+    }
+    if c.Instance != "" {
+        m["instance"] = c.Instance
+    }
+    return m
+}
+
+func (c Problem) MarshalJSON() ([]byte, error) {
+    return json.Marshal(c.members())
+}
+
+func (c Problem) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+    start = xml.StartElement{
+        Name: xml.Name{Local: "problem"},
+        Attr: []xml.Attr{{Name: xml.Name{Local: "xmlns"}, Value: "urn:ietf:rfc:7807"}},
+    }
+    err := e.EncodeToken(start)
+    if err != nil {
+        return err
+    }
+    members := c.members()
+    names := []string{"type", "title", "status", "detail", "instance"}
+    extensions := []string{}
+    for name := range members {
+        if !strings.Contains(" type title status detail instance ", " "+name+" ") {
+            extensions = append(extensions, name)
+        }
+    }
+    sort.Strings(extensions)
+    for _, name := range append(names, extensions...) {
+        value, ok := members[name]
+        if !ok {
+            continue
+        }
+        err = e.EncodeElement(value, xml.StartElement{Name: xml.Name{Local: name}})
+        if err != nil {
+            return err
+        }
+    }
+    return e.EncodeToken(start.End())
+}
+
+// the problem details chosen by the resource
+type problemDetails struct {
+    problem Problem
+}
+
+// Problem returns the problem details as application/problem+xml if the
+// client accepts XML, or application/problem+json otherwise. Type, Title and
+// Instance default to about:blank, the status text and the request URI, and
+// Status to 500 if it is not a valid status code.
+func (c *Ctx) Problem(problem Problem) problemDetails {
+    return problemDetails{problem}
+}
+
+// problemType returns the problem media type negotiated by the Accept
+// header, or "" if the client prefers HTML or plain text.
+func problemType(accept string) MediaType {
+    provided := MediaTypes{"application/problem+json", "application/json",
+        "application/problem+xml", "application/xml", "text/html", "text/plain"}
+    switch chooseType(provided, accept) {
+    case "application/problem+json", "application/json":
+        return "application/problem+json"
+    case "application/problem+xml", "application/xml":
+        return "application/problem+xml"
+    }
+    return ""
+}
+
+// frameworkProblem returns the problem details of the errors without bodies,
+// which are written as plain text otherwise, and sets their headers.
+func frameworkProblem(w *wrappedWriter, response interface{}) *Problem {
+    switch v := response.(type) {
+    case badRequest:
+        if v.body == nil {
+            return &Problem{Status: http.StatusBadRequest, Detail: v.reason}
+        }
+    case unauthorized:
+        if v.body == nil {
+            for _, challenge := range v.wwwAuthHeaders {
+                if challenge != "" {
+                    w.Header().Add("WWW-Authenticate", challenge)
+                }
+            }
+            return &Problem{Status: http.StatusUnauthorized}
+        }
+    case forbidden:
+        if v.body == nil {
+            return &Problem{Status: http.StatusForbidden, Detail: v.reason}
+        }
+    case notFound:
+        if v.body == nil {
+            return &Problem{Status: http.StatusNotFound}
+        }
+    case methodNotAllowed:
+        w.Header().Set("Allow", strings.Join(v.allowed, ", "))
+        return &Problem{
+            Status: http.StatusMethodNotAllowed,
+            Extensions: map[string]interface{}{"allowed": v.allowed},
+        }
+    case notAcceptable:
+        return &Problem{
+            Status: http.StatusNotAcceptable,
+            Extensions: map[string]interface{}{"provided": v.provided},
+        }
+    case unsupportedMediaType:
+        if v.body == nil {
+            return &Problem{Status: http.StatusUnsupportedMediaType}
+        }
+    case internalError:
+        w.err = v
+        return &Problem{
+            Status: http.StatusInternalServerError,
+            Extensions: map[string]interface{}{"code": v.code, "request_id": w.requestID},
+        }
+    case error:
+        w.err = internalError{
+            why: v.Error(),
+            code: errorCode(v.Error()),
+        }
+        return &Problem{
+            Status: http.StatusInternalServerError,
+            Extensions: map[string]interface{}{"code": w.err.code, "request_id": w.requestID},
+        }
+    }
+    return nil
+}
+
+func (c *webApp) writeProblem(w *wrappedWriter, r *http.Request, problem Problem, mediaType MediaType) {
+    if problem.Status < 100 || problem.Status > 599 {
+        problem.Status = http.StatusInternalServerError
+    }
+    if problem.Type == "" {
+        problem.Type = "about:blank"
+    }
+    if problem.Title == "" {
+        problem.Title = http.StatusText(problem.Status)
+    }
+    if problem.Instance == "" {
+        problem.Instance = r.URL.RequestURI()
+    }
+
+    var body []byte
+    var err error
+    if mediaType == "application/problem+xml" {
+        body, err = xml.Marshal(problem)
+    } else {
+        mediaType = "application/problem+json"
+        body, err = json.Marshal(problem)
+    }
+    if err != nil {
+        http.Error(w, fmt.Sprintf("%s: %s", http.StatusText(http.StatusInternalServerError), err),
+            http.StatusInternalServerError)
+        return
+    }
+    w.Header().Set("Content-Type", string(mediaType))
+    w.WriteHeader(problem.Status)
+    w.Write(body)
+}
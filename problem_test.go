@@ -0,0 +1,99 @@
+package vitali
+
+import (
+    "fmt"
+    "testing"
+    "net/http"
+    "net/http/httptest"
+)
+
+type ProblemTest struct {
+    Ctx
+    Perm `DELETE:"ADMIN"`
+}
+
+func (c ProblemTest) Get() interface{} {
+    return c.Problem(Problem{
+        Type: "https://example.com/probs/out-of-credit",
+        Title: "You do not have enough credit.",
+        Status: http.StatusForbidden,
+        Extensions: map[string]interface{}{"balance": 30},
+    })
+}
+
+func (c ProblemTest) Post() interface{} {
+    panic("boom")
+}
+
+func (c ProblemTest) Delete() interface{} {
+    return "deleted"
+}
+
+type ProblemNoStatusTest struct {
+    Ctx
+}
+
+func (c ProblemNoStatusTest) Get() interface{} {
+    return c.Problem(Problem{Title: "no status"})
+}
+
+func TestProblemDetails(t *testing.T) {
+    webapp := CreateWebApp([]RouteRule{
+        {"/problem", ProblemTest{}},
+        {"/nostatus", ProblemNoStatusTest{}},
+    })
+    webapp.ProblemDetails = true
+    webapp.TrustedProxies = []string{"192.0.2.1"}
+
+    tests := []struct {
+        method string
+        path string
+        accept string
+        code int
+        contentType string
+        body string
+    }{
+        {"GET", "/problem", "application/json", http.StatusForbidden, "application/problem+json",
+            `{"balance":30,"instance":"/problem","status":403,"title":"You do not have enough credit.",` +
+            `"type":"https://example.com/probs/out-of-credit"}`},
+        {"GET", "/problem", "application/problem+xml", http.StatusForbidden, "application/problem+xml",
+            `<problem xmlns="urn:ietf:rfc:7807"><type>https://example.com/probs/out-of-credit</type>` +
+            `<title>You do not have enough credit.</title><status>403</status>` +
+            `<instance>/problem</instance><balance>30</balance></problem>`},
+        {"GET", "/none?x=1", "application/json", http.StatusNotFound, "application/problem+json",
+            `{"instance":"/none?x=1","status":404,"title":"Not Found","type":"about:blank"}`},
+        {"PUT", "/problem", "application/json", http.StatusMethodNotAllowed, "application/problem+json",
+            `{"allowed":["DELETE","HEAD","GET","POST"],"instance":"/problem","status":405,` +
+            `"title":"Method Not Allowed","type":"about:blank"}`},
+        {"DELETE", "/problem", "application/json", http.StatusUnauthorized, "application/problem+json",
+            `{"instance":"/problem","status":401,"title":"Unauthorized","type":"about:blank"}`},
+        {"POST", "/problem", "application/json", http.StatusInternalServerError, "application/problem+json",
+            `{"code":` + fmt.Sprint(errorCode("boom")) + `,"instance":"/problem","request_id":"req-1",` +
+            `"status":500,"title":"Internal Server Error","type":"about:blank"}`},
+        {"GET", "/none", "text/html", http.StatusNotFound, "text/plain; charset=utf-8", "Not Found\n"},
+        {"GET", "/none", "*/*", http.StatusNotFound, "application/problem+json",
+            `{"instance":"/none","status":404,"title":"Not Found","type":"about:blank"}`},
+        {"GET", "/none", "application/json;q=0, text/plain", http.StatusNotFound,
+            "text/plain; charset=utf-8", "Not Found\n"},
+        {"GET", "/none", "text/html, application/xml;q=0.9", http.StatusNotFound,
+            "text/plain; charset=utf-8", "Not Found\n"},
+        {"GET", "/nostatus", "application/json", http.StatusInternalServerError, "application/problem+json",
+            `{"instance":"/nostatus","status":500,"title":"no status","type":"about:blank"}`},
+    }
+    for i, test := range tests {
+        r := httptest.NewRequest(test.method, test.path, nil)
+        r.Header.Set("Accept", test.accept)
+        r.Header.Set("X-Request-ID", "req-1")
+        rr := httptest.NewRecorder()
+        webapp.ServeHTTP(rr, r)
+        if rr.Code != test.code {
+            t.Errorf("#%d response code is %d", i, rr.Code)
+        }
+        if rr.Header().Get("Content-Type") != test.contentType {
+            t.Errorf("#%d content type is %s", i, rr.Header().Get("Content-Type"))
+        }
+        if rr.Body.String() != test.body {
+            t.Errorf("#%d entity is `%s`", i, rr.Body.String())
+        }
+    }
+}
@@ -0,0 +1,79 @@
+package vitali
+
+import (
+    "net"
+    "net/http"
+    "crypto/rand"
+    "encoding/hex"
+)
+
+// the header carrying the request id from the trusted proxies, and back to
+// the clients
+const RequestIDHeader = "X-Request-ID"
+
+func newRequestID() string {
+    buf := make([]byte, 16)
+    _, err := rand.Read(buf)
+    if err != nil {
+        panic(err)
+    }
+    return hex.EncodeToString(buf)
+}
+
+func validRequestID(id string) bool {
+    if id == "" || len(id) > 128 {
+        return false
+    }
+    for _, ch := range id {
+        if !(ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || ch >= '0' && ch <= '9' ||
+                ch == '-' || ch == '_' || ch == '.' || ch == ':' || ch == '+' || ch == '/' || ch == '=') {
+            return false
+        }
+    }
+    return true
+}
+
+// requestID returns the X-Request-ID of the request if it comes from a
+// trusted proxy, or a new random id.
+func (c *webApp) requestID(r *http.Request) string {
+    id := r.Header.Get(RequestIDHeader)
+    if validRequestID(id) {
+        host, _, err := net.SplitHostPort(r.RemoteAddr)
+        if err != nil {
+            host = r.RemoteAddr
+        }
+        if c.isTrustedProxy(host) {
+            return id
+        }
+    }
+    return newRequestID()
+}
+
+// requestLogger adds the request_id field to the records.
+type requestLogger struct {
+    logger Logger
+    requestID string
+}
+
+func (c requestLogger) Log(level Level, msg string, keyvals ...interface{}) {
+    fields := make([]interface{}, 0, len(keyvals)+2)
+    fields = append(fields, keyvals...)
+    fields = append(fields, "request_id", c.requestID)
+    c.logger.Log(level, msg, fields...)
+}
+
+// requestLogger returns the Logger of the webapp adding the request id.
+func (c *webApp) requestLogger(requestID string) Logger {
+    if requestID == "" {
+        return c.logger()
+    }
+    return requestLogger{c.logger(), requestID}
+}
+
+// logger returns the Logger of the request.
+func (c *Ctx) logger() Logger {
+    if c.app == nil {
+        return DefaultLogger
+    }
+    return c.app.requestLogger(c.RequestID)
+}
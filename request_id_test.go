@@ -0,0 +1,69 @@
+package vitali
+
+import (
+    "fmt"
+    "testing"
+    "html/template"
+    "net/http/httptest"
+)
+
+type RequestIDTest struct {
+    Ctx
+}
+
+func (c *RequestIDTest) Get() interface{} {
+    return c.RequestID
+}
+
+func (c *RequestIDTest) Post() interface{} {
+    panic("boom")
+}
+
+func TestRequestID(t *testing.T) {
+    webapp := CreateWebApp([]RouteRule{
+        {"/requestid", RequestIDTest{}},
+    })
+    logger := &recordLogger{}
+    webapp.Logger = logger
+    webapp.ErrTemplate = template.Must(template.New("err").Parse("{{.Code}} {{.RequestID}}"))
+
+    request := func(method string, remoteAddr string, id string) *httptest.ResponseRecorder {
+        r := httptest.NewRequest(method, "/requestid", nil)
+        r.RemoteAddr = remoteAddr
+        if id != "" {
+            r.Header.Set("X-Request-ID", id)
+        }
+        rr := httptest.NewRecorder()
+        webapp.ServeHTTP(rr, r)
+        return rr
+    }
+
+    rr := request("GET", "10.0.0.1:1234", "abc-1")
+    id := rr.Header().Get("X-Request-ID")
+    if len(id) != 32 || id == "abc-1" || rr.Body.String() != id {
+        t.Errorf("untrusted request id is %s, entity is `%s`", id, rr.Body.String())
+    }
+    if logger.records[0].fields["request_id"] != id {
+        t.Errorf("record is %v", logger.records[0])
+    }
+
+    webapp.TrustedProxies = []string{"10.0.0.1"}
+    rr = request("GET", "10.0.0.1:1234", "abc-1")
+    if rr.Header().Get("X-Request-ID") != "abc-1" || rr.Body.String() != "abc-1" {
+        t.Errorf("trusted request id is %s", rr.Header().Get("X-Request-ID"))
+    }
+    rr = request("GET", "10.0.0.1:1234", "abc 1\"")
+    if len(rr.Header().Get("X-Request-ID")) != 32 {
+        t.Errorf("invalid request id is %s", rr.Header().Get("X-Request-ID"))
+    }
+
+    rr = request("POST", "10.0.0.1:1234", "abc-2")
+    expected := fmt.Sprintf("%d abc-2", errorCode("boom"))
+    if rr.Body.String() != expected {
+        t.Errorf("error entity is `%s`", rr.Body.String())
+    }
+    record := logger.records[len(logger.records)-1]
+    if record.level != LevelError || record.fields["request_id"] != "abc-2" {
+        t.Errorf("record is %v", record)
+    }
+}
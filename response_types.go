@@ -1,5 +1,28 @@
 package vitali
 
+import (
+    "net/http"
+)
+
+// 201
+type created struct {
+    body interface{}
+    uri string
+}
+
+func (c *Ctx) Created(uri string, bodies ...interface{}) created {
+    return created{extractBody(bodies), uri}
+}
+
+// 202
+type accepted struct {
+    body interface{}
+}
+
+func (c *Ctx) Accepted(bodies ...interface{}) accepted {
+    return accepted{extractBody(bodies)}
+}
+
 //204
 type  noContent struct {
 }
@@ -44,6 +67,15 @@ func (c *Ctx) TempRedirect(uri string) tempRedirect {
     return tempRedirect{uri}
 }
 
+// 308
+type permanentRedirect struct {
+    uri string
+}
+
+func (c *Ctx) PermanentRedirect(uri string) permanentRedirect {
+    return permanentRedirect{uri}
+}
+
 // 400
 type badRequest struct {
     body interface{}
@@ -57,20 +89,21 @@ func (c *Ctx) BadRequest(reason string, bodies ...interface{}) badRequest {
 // 401
 type unauthorized struct {
     body interface{}
-    wwwAuthHeader string
+    wwwAuthHeaders []string
 }
 
 func (c *Ctx) Unauthorized(wwwAuthHeader string, bodies ...interface{}) unauthorized {
-    return unauthorized{extractBody(bodies), wwwAuthHeader}
+    return unauthorized{extractBody(bodies), []string{wwwAuthHeader}}
 }
 
 // 403
 type forbidden struct {
     body interface{}
+    reason string
 }
 
 func (c *Ctx) Forbidden(bodies ...interface{}) forbidden {
-    return forbidden{extractBody(bodies)}
+    return forbidden{extractBody(bodies), ""}
 }
 
 // 404
@@ -100,6 +133,42 @@ func (c *Ctx) NotAcceptable(provided MediaTypes) notAcceptable {
     return notAcceptable{provided}
 }
 
+// 409
+type conflict struct {
+    body interface{}
+}
+
+func (c *Ctx) Conflict(bodies ...interface{}) conflict {
+    return conflict{extractBody(bodies)}
+}
+
+// 410
+type gone struct {
+    body interface{}
+}
+
+func (c *Ctx) Gone(bodies ...interface{}) gone {
+    return gone{extractBody(bodies)}
+}
+
+// 412
+type preconditionFailed struct {
+    body interface{}
+}
+
+func (c *Ctx) PreconditionFailed(bodies ...interface{}) preconditionFailed {
+    return preconditionFailed{extractBody(bodies)}
+}
+
+// 413
+type requestEntityTooLarge struct {
+    body interface{}
+}
+
+func (c *Ctx) RequestEntityTooLarge(bodies ...interface{}) requestEntityTooLarge {
+    return requestEntityTooLarge{extractBody(bodies)}
+}
+
 // 415
 type unsupportedMediaType struct {
     body interface{}
@@ -109,6 +178,25 @@ func (c *Ctx) UnsupportedMediaType(bodies ...interface{}) unsupportedMediaType {
     return unsupportedMediaType{extractBody(bodies)}
 }
 
+// 422
+type unprocessableEntity struct {
+    body interface{}
+}
+
+func (c *Ctx) UnprocessableEntity(bodies ...interface{}) unprocessableEntity {
+    return unprocessableEntity{extractBody(bodies)}
+}
+
+// 429
+type tooManyRequests struct {
+    body interface{}
+    seconds int
+}
+
+func (c *Ctx) TooManyRequests(seconds int, bodies ...interface{}) tooManyRequests {
+    return tooManyRequests{extractBody(bodies), seconds}
+}
+
 // 501
 type notImplemented struct {
     body interface{}
@@ -118,6 +206,15 @@ func (c *Ctx) NotImplemented(bodies ...interface{}) notImplemented {
     return notImplemented{extractBody(bodies)}
 }
 
+// 502
+type badGateway struct {
+    body interface{}
+}
+
+func (c *Ctx) BadGateway(bodies ...interface{}) badGateway {
+    return badGateway{extractBody(bodies)}
+}
+
 // 503
 type serviceUnavailable struct {
     body interface{}
@@ -128,6 +225,27 @@ func (c *Ctx) ServiceUnavailable(seconds int, bodies ...interface{}) serviceUnav
     return serviceUnavailable{extractBody(bodies), seconds}
 }
 
+// 504
+type gatewayTimeout struct {
+    body interface{}
+}
+
+func (c *Ctx) GatewayTimeout(bodies ...interface{}) gatewayTimeout {
+    return gatewayTimeout{extractBody(bodies)}
+}
+
+// any status code with the headers, and the body marshaled like the others
+// if it is not nil
+type status struct {
+    code int
+    body interface{}
+    headers http.Header
+}
+
+func (c *Ctx) Status(code int, body interface{}, headers http.Header) status {
+    return status{code, body, headers}
+}
+
 // return this if client is disconnected
 type clientGone struct {
 }
@@ -141,6 +259,8 @@ type internalError struct {
     where string
     why string
     code uint32
+    err error
+    panicked bool
 }
 
 func (c *Ctx) InternalError(e error) internalError {
@@ -148,6 +268,7 @@ func (c *Ctx) InternalError(e error) internalError {
         where: lineInfo(1),
         why: e.Error(),
         code: errorCode(e.Error()),
+        err: e,
     }
 }
 
@@ -0,0 +1,291 @@
+package vitali
+
+import (
+    "time"
+    "context"
+    "strings"
+    "net/http"
+    "crypto/rand"
+    "encoding/json"
+    "encoding/base64"
+)
+
+// SessionStore keeps the session data referred to by the session cookie.
+// Save returns the new cookie value, which is a new session id when key is
+// empty for the server side stores, or the data itself for CookieStore.
+type SessionStore interface {
+    Load(key string) ([]byte, error)
+    Save(key string, data []byte, maxAge time.Duration) (string, error)
+    Delete(key string) error
+}
+
+// SessionManager loads the session of a request from its cookie, and saves it
+// after the resource method returns. Sessions expire MaxAge after they are
+// created, or IdleTimeout after the last request if it is set.
+type SessionManager struct {
+    Store SessionStore
+    CookieName string
+    Path string
+    Domain string
+    MaxAge time.Duration
+    IdleTimeout time.Duration
+    Secure bool
+    HttpOnly bool
+    SameSite http.SameSite
+}
+
+func CreateSessionManager(store SessionStore) *SessionManager {
+    return &SessionManager{
+        Store: store,
+        CookieName: "vitali_session",
+        Path: "/",
+        MaxAge: 24*time.Hour,
+        HttpOnly: true,
+        SameSite: http.SameSiteLaxMode,
+    }
+}
+
+type sessionData struct {
+    Values map[string]string `json:"v"`
+    Created int64 `json:"c"`
+    Accessed int64 `json:"a"`
+}
+
+type Session struct {
+    manager *SessionManager
+    key string
+    data sessionData
+    loaded bool
+    dirty bool
+    destroyed bool
+    // the error deleting the old session when it is regenerated
+    deleteErr error
+}
+
+// holds the session and the CSRF token shared by the copies of Ctx in a
+// request, and by SessionUserProvider through the request context
+type sessionSlot struct {
+    sessions *SessionManager
+    session *Session
+    csrfToken string
+}
+
+type sessionSlotKey struct{}
+
+// withSessionSlot returns the request carrying the session slot if the
+// webapp has sessions.
+func withSessionSlot(r *http.Request, slot *sessionSlot) *http.Request {
+    if slot.sessions == nil {
+        return r
+    }
+    return r.WithContext(context.WithValue(r.Context(), sessionSlotKey{}, slot))
+}
+
+// Session returns the session of the request. It panics if webapp.Sessions
+// is not set, which is answered by 500.
+func (c *Ctx) Session() *Session {
+    if c.session == nil || c.app == nil || c.app.Sessions == nil {
+        panic("vitali: webapp.Sessions is not set")
+    }
+    if c.session.session == nil {
+        c.session.session = c.app.Sessions.Load(c.Request)
+    }
+    return c.session.session
+}
+
+func (c *Session) Get(key string) string {
+    return c.data.Values[key]
+}
+
+func (c *Session) Set(key string, value string) {
+    c.data.Values[key] = value
+    c.dirty = true
+}
+
+func (c *Session) Delete(key string) {
+    delete(c.data.Values, key)
+    c.dirty = true
+}
+
+// Regenerate moves the session to a new id, which should be done when the
+// user logs in to prevent session fixation.
+// A destroyed session is started again.
+func (c *Session) Regenerate() {
+    if c.key != "" {
+        c.deleteErr = c.manager.Store.Delete(c.key)
+        c.key = ""
+    }
+    c.data.Created = time.Now().Unix()
+    c.dirty = true
+    c.destroyed = false
+}
+
+// Destroy removes the session and its cookie.
+func (c *Session) Destroy() {
+    c.data.Values = make(map[string]string)
+    c.destroyed = true
+}
+
+// Login regenerates the session and saves the user and roles read by
+// SessionUserProvider.
+func (c *Session) Login(user string, roles ...string) {
+    c.Regenerate()
+    c.Delete(csrfSessionKey)
+    c.Set("_user", user)
+    c.Set("_roles", strings.Join(roles, " "))
+}
+
+func (c *Session) User() string {
+    return c.Get("_user")
+}
+
+func (c *Session) Roles() []string {
+    return strings.Fields(c.Get("_roles"))
+}
+
+// Load returns the session of the request, or a new one if there is none or
+// it is expired.
+func (c *SessionManager) Load(r *http.Request) *Session {
+    now := time.Now().Unix()
+    session := &Session{
+        manager: c,
+        data: sessionData{make(map[string]string), now, now},
+    }
+    cookie, err := r.Cookie(c.CookieName)
+    if err != nil || cookie.Value == "" {
+        return session
+    }
+
+    content, err := c.Store.Load(cookie.Value)
+    if err != nil || content == nil {
+        return session
+    }
+    var data sessionData
+    if json.Unmarshal(content, &data) != nil || data.Values == nil {
+        return session
+    }
+    if (c.MaxAge > 0 && now - data.Created > int64(c.MaxAge / time.Second)) ||
+            (c.IdleTimeout > 0 && now - data.Accessed > int64(c.IdleTimeout / time.Second)) {
+        c.Store.Delete(cookie.Value)
+        return session
+    }
+    session.key = cookie.Value
+    session.data = data
+    session.loaded = true
+    return session
+}
+
+// Save stores the session if it is changed, or touched when IdleTimeout is
+// set, and sets the cookie.
+func (c *SessionManager) Save(w http.ResponseWriter, session *Session) error {
+    cookie := &http.Cookie{
+        Name: c.CookieName,
+        Path: c.Path,
+        Domain: c.Domain,
+        Secure: c.Secure,
+        HttpOnly: c.HttpOnly,
+        SameSite: c.SameSite,
+    }
+    if session.destroyed {
+        if session.key != "" {
+            err := c.Store.Delete(session.key)
+            if err != nil {
+                return err
+            }
+        }
+        if session.loaded {
+            cookie.MaxAge = -1
+            http.SetCookie(w, cookie)
+        }
+        return nil
+    }
+    if !session.dirty && !(session.loaded && c.IdleTimeout > 0) {
+        return nil
+    }
+
+    now := time.Now()
+    session.data.Accessed = now.Unix()
+    content, err := json.Marshal(session.data)
+    if err != nil {
+        return err
+    }
+    session.key, err = c.Store.Save(session.key, content, c.lifetime(session, now))
+    if err != nil {
+        return err
+    }
+    cookie.Value = session.key
+    if c.MaxAge > 0 {
+        expires := time.Unix(session.data.Created, 0).Add(c.MaxAge)
+        cookie.Expires = expires
+        cookie.MaxAge = int(expires.Sub(time.Now()) / time.Second)
+    }
+    http.SetCookie(w, cookie)
+    return nil
+}
+
+// lifetime returns how long the store keeps the session, until MaxAge after
+// it is created or IdleTimeout from now, whichever comes first.
+func (c *SessionManager) lifetime(session *Session, now time.Time) time.Duration {
+    var lifetime time.Duration
+    if c.MaxAge > 0 {
+        lifetime = time.Unix(session.data.Created, 0).Add(c.MaxAge).Sub(now)
+        if lifetime < time.Second {
+            lifetime = time.Second
+        }
+    }
+    if c.IdleTimeout > 0 && (lifetime == 0 || c.IdleTimeout < lifetime) {
+        lifetime = c.IdleTimeout
+    }
+    return lifetime
+}
+
+func (c *webApp) saveSession(w http.ResponseWriter, ctx *Ctx) {
+    if ctx.session == nil || ctx.session.session == nil {
+        return
+    }
+    session := ctx.session.session
+    if session.deleteErr != nil {
+        ctx.logger().Log(LevelError, "failed to delete session", "error", session.deleteErr)
+    }
+    err := c.Sessions.Save(w, session)
+    if err != nil {
+        ctx.logger().Log(LevelError, "failed to save session", "error", err)
+    }
+}
+
+func newSessionID() string {
+    buf := make([]byte, 32)
+    _, err := rand.Read(buf)
+    if err != nil {
+        panic(err)
+    }
+    return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+// SessionUserProvider authenticates the user logged in by Session.Login.
+type SessionUserProvider struct {
+    Sessions *SessionManager
+}
+
+func (c *SessionUserProvider) AuthHeader(r *http.Request) string {
+    return ""
+}
+
+func (c *SessionUserProvider) AuthScheme() string {
+    return "Session"
+}
+
+// GetUserAndRoles reads the session loaded for the request if it is of the
+// same SessionManager, which is then reused by Ctx.Session.
+func (c *SessionUserProvider) GetUserAndRoles(r *http.Request) (string, []string) {
+    var session *Session
+    if slot, ok := r.Context().Value(sessionSlotKey{}).(*sessionSlot); ok && slot.sessions == c.Sessions {
+        if slot.session == nil {
+            slot.session = c.Sessions.Load(r)
+        }
+        session = slot.session
+    } else {
+        session = c.Sessions.Load(r)
+    }
+    return session.User(), session.Roles()
+}
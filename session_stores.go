@@ -0,0 +1,300 @@
+package vitali
+
+import (
+    "os"
+    "io"
+    "fmt"
+    "bufio"
+    "bytes"
+    "strconv"
+    "sync"
+    "time"
+    "errors"
+    "regexp"
+    "strings"
+    "io/ioutil"
+    "crypto/aes"
+    "crypto/rand"
+    "crypto/cipher"
+    "crypto/sha256"
+    "path/filepath"
+    "encoding/base64"
+)
+
+// CookieStore keeps the whole session in the cookie, encrypted and
+// authenticated with AES-GCM. The first secret is used to encrypt, and all of
+// them are tried to decrypt so that the secret can be rotated.
+type CookieStore struct {
+    aeads []cipher.AEAD
+}
+
+func CreateCookieStore(secrets ...string) *CookieStore {
+    if len(secrets) == 0 {
+        panic("vitali: CookieStore needs a secret")
+    }
+    c := &CookieStore{}
+    for _, secret := range secrets {
+        key := sha256.Sum256([]byte(secret))
+        block, err := aes.NewCipher(key[:])
+        if err != nil {
+            panic(err)
+        }
+        aead, err := cipher.NewGCM(block)
+        if err != nil {
+            panic(err)
+        }
+        c.aeads = append(c.aeads, aead)
+    }
+    return c
+}
+
+func (c *CookieStore) Load(key string) ([]byte, error) {
+    sealed, err := base64.RawURLEncoding.DecodeString(key)
+    if err != nil {
+        return nil, err
+    }
+    for _, aead := range c.aeads {
+        if len(sealed) < aead.NonceSize() {
+            return nil, errors.New("invalid session cookie")
+        }
+        data, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+        if err == nil {
+            return data, nil
+        }
+    }
+    return nil, errors.New("invalid session cookie")
+}
+
+func (c *CookieStore) Save(key string, data []byte, maxAge time.Duration) (string, error) {
+    aead := c.aeads[0]
+    nonce := make([]byte, aead.NonceSize())
+    _, err := io.ReadFull(rand.Reader, nonce)
+    if err != nil {
+        return "", err
+    }
+    value := base64.RawURLEncoding.EncodeToString(aead.Seal(nonce, nonce, data, nil))
+    if len(value) > 4000 {
+        return "", errors.New("session is too large for a cookie")
+    }
+    return value, nil
+}
+
+func (c *CookieStore) Delete(key string) error {
+    return nil
+}
+
+// the expired sessions are swept from the server side stores at most once
+// in the interval, when a session is saved
+var sessionSweepInterval = time.Minute
+
+type memorySession struct {
+    data []byte
+    expires time.Time
+}
+
+// MemoryStore keeps the sessions in memory, which are lost when the server
+// restarts.
+type MemoryStore struct {
+    lock sync.Mutex
+    sessions map[string]memorySession
+    swept time.Time
+}
+
+func CreateMemoryStore() *MemoryStore {
+    return &MemoryStore{
+        sessions: make(map[string]memorySession),
+        swept: time.Now(),
+    }
+}
+
+func (c *MemoryStore) Load(key string) ([]byte, error) {
+    c.lock.Lock()
+    defer c.lock.Unlock()
+    session, ok := c.sessions[key]
+    if !ok || (!session.expires.IsZero() && session.expires.Before(time.Now())) {
+        return nil, nil
+    }
+    return session.data, nil
+}
+
+func (c *MemoryStore) Save(key string, data []byte, maxAge time.Duration) (string, error) {
+    c.lock.Lock()
+    defer c.lock.Unlock()
+    now := time.Now()
+    if now.Sub(c.swept) >= sessionSweepInterval {
+        c.sweep(now)
+    }
+    if key == "" {
+        key = newSessionID()
+    }
+    session := memorySession{data: data}
+    if maxAge > 0 {
+        session.expires = now.Add(maxAge)
+    }
+    c.sessions[key] = session
+    return key, nil
+}
+
+func (c *MemoryStore) Delete(key string) error {
+    c.lock.Lock()
+    defer c.lock.Unlock()
+    delete(c.sessions, key)
+    return nil
+}
+
+// sweep removes the expired sessions. The lock must be held.
+func (c *MemoryStore) sweep(now time.Time) {
+    for k, session := range c.sessions {
+        if !session.expires.IsZero() && session.expires.Before(now) {
+            delete(c.sessions, k)
+        }
+    }
+    c.swept = now
+}
+
+var sessionIDRe = regexp.MustCompile("^[A-Za-z0-9_-]{43}$")
+
+// FileStore keeps each session in a file named by the session id in Dir,
+// after a line with the Unix time it expires at, or 0 if it does not. The
+// expired files are removed by Sweep, which is also run in the background
+// when the sessions are saved.
+type FileStore struct {
+    Dir string
+
+    lock sync.Mutex
+    swept time.Time
+}
+
+func CreateFileStore(dir string) (*FileStore, error) {
+    err := os.MkdirAll(dir, 0700)
+    if err != nil {
+        return nil, err
+    }
+    return &FileStore{Dir: dir, swept: time.Now()}, nil
+}
+
+func (c *FileStore) path(key string) (string, error) {
+    if !sessionIDRe.MatchString(key) {
+        return "", errors.New("invalid session id")
+    }
+    return filepath.Join(c.Dir, key), nil
+}
+
+// readExpires reads the expiry line of a session file.
+func readExpires(r *bufio.Reader) (time.Time, error) {
+    line, err := r.ReadString('\n')
+    if err != nil {
+        return time.Time{}, errors.New("invalid session file")
+    }
+    expires, err := strconv.ParseInt(line[:len(line)-1], 10, 64)
+    if err != nil {
+        return time.Time{}, errors.New("invalid session file")
+    }
+    if expires == 0 {
+        return time.Time{}, nil
+    }
+    return time.Unix(expires, 0), nil
+}
+
+func (c *FileStore) Load(key string) ([]byte, error) {
+    path, err := c.path(key)
+    if err != nil {
+        return nil, err
+    }
+    content, err := ioutil.ReadFile(path)
+    if os.IsNotExist(err) {
+        return nil, nil
+    } else if err != nil {
+        return nil, err
+    }
+    r := bufio.NewReader(bytes.NewReader(content))
+    expires, err := readExpires(r)
+    if err != nil {
+        return nil, err
+    }
+    if !expires.IsZero() && expires.Before(time.Now()) {
+        os.Remove(path)
+        return nil, nil
+    }
+    return ioutil.ReadAll(r)
+}
+
+func (c *FileStore) Save(key string, data []byte, maxAge time.Duration) (string, error) {
+    if key == "" {
+        key = newSessionID()
+    }
+    path, err := c.path(key)
+    if err != nil {
+        return "", err
+    }
+    now := time.Now()
+    var expires int64
+    if maxAge > 0 {
+        expires = now.Add(maxAge).Unix()
+    }
+    tmp, err := ioutil.TempFile(c.Dir, ".tmp-")
+    if err != nil {
+        return "", err
+    }
+    _, err = fmt.Fprintf(tmp, "%d\n%s", expires, data)
+    tmp.Close()
+    if err == nil {
+        err = os.Rename(tmp.Name(), path)
+    }
+    if err != nil {
+        os.Remove(tmp.Name())
+        return "", err
+    }
+
+    c.lock.Lock()
+    if now.Sub(c.swept) >= sessionSweepInterval {
+        c.swept = now
+        go c.Sweep()
+    }
+    c.lock.Unlock()
+    return key, nil
+}
+
+func (c *FileStore) Delete(key string) error {
+    path, err := c.path(key)
+    if err != nil {
+        return err
+    }
+    err = os.Remove(path)
+    if os.IsNotExist(err) {
+        return nil
+    }
+    return err
+}
+
+// Sweep removes the files of the expired sessions, and the temporary files
+// left by failed saves.
+func (c *FileStore) Sweep() error {
+    files, err := ioutil.ReadDir(c.Dir)
+    if err != nil {
+        return err
+    }
+    now := time.Now()
+    for _, file := range files {
+        path := filepath.Join(c.Dir, file.Name())
+        if strings.HasPrefix(file.Name(), ".tmp-") {
+            if now.Sub(file.ModTime()) >= sessionSweepInterval {
+                os.Remove(path)
+            }
+            continue
+        }
+        if !sessionIDRe.MatchString(file.Name()) {
+            continue
+        }
+        f, err := os.Open(path)
+        if err != nil {
+            continue
+        }
+        expires, err := readExpires(bufio.NewReader(f))
+        f.Close()
+        if err == nil && !expires.IsZero() && expires.Before(now) {
+            os.Remove(path)
+        }
+    }
+    return nil
+}
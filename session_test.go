@@ -0,0 +1,232 @@
+package vitali
+
+import (
+    "os"
+    "time"
+    "testing"
+    "net/http"
+    "net/url"
+    "io/ioutil"
+    "net/http/httptest"
+)
+
+type SessionTest struct {
+    Ctx
+    Perm `DELETE:"ADMIN"`
+}
+
+func (c *SessionTest) Get() interface{} {
+    return c.Session().Get("foo")
+}
+
+func (c *SessionTest) Post() interface{} {
+    if c.Param("login") != "" {
+        c.Session().Login(c.Param("login"), "ADMIN")
+    }
+    c.Session().Set("foo", c.Param("foo"))
+    return c.NoContent()
+}
+
+func (c *SessionTest) Delete() interface{} {
+    c.Session().Destroy()
+    if c.Param("login") != "" {
+        c.Session().Login(c.Param("login"), "ADMIN")
+    }
+    return c.Username
+}
+
+func sessionRequest(webapp webApp, method string, form url.Values, cookie *http.Cookie) (*httptest.ResponseRecorder, *http.Cookie) {
+    r := &http.Request{
+        Method: method,
+        Host:   "lunastorm.tw",
+        URL: &url.URL{
+            Path: "/session",
+        },
+        Form: form,
+        Header: make(http.Header),
+    }
+    if cookie != nil {
+        r.AddCookie(cookie)
+    }
+    rr := httptest.NewRecorder()
+    webapp.ServeHTTP(rr, r)
+    for _, c := range rr.Result().Cookies() {
+        if c.Name == "vitali_session" {
+            return rr, c
+        }
+    }
+    return rr, nil
+}
+
+func TestSession(t *testing.T) {
+    dir, _ := ioutil.TempDir("", "vitali-session-")
+    defer os.RemoveAll(dir)
+    fileStore, _ := CreateFileStore(dir)
+    stores := map[string]SessionStore{
+        "cookie": CreateCookieStore("secret"),
+        "memory": CreateMemoryStore(),
+        "file": fileStore,
+    }
+
+    for name, store := range stores {
+        webapp := CreateWebApp([]RouteRule{
+            {"/session", SessionTest{}},
+        })
+        webapp.Sessions = CreateSessionManager(store)
+        webapp.UserProvider = &SessionUserProvider{webapp.Sessions}
+
+        rr, cookie := sessionRequest(webapp, "GET", nil, nil)
+        if rr.Body.String() != "" || cookie != nil {
+            t.Errorf("%s: new session is `%s`, cookie %v", name, rr.Body.String(), cookie)
+        }
+
+        rr, cookie = sessionRequest(webapp, "POST", url.Values{"foo": {"bar"}}, nil)
+        if cookie == nil || !cookie.HttpOnly || cookie.SameSite != http.SameSiteLaxMode || cookie.MaxAge <= 0 {
+            t.Fatalf("%s: cookie is %v", name, cookie)
+        }
+        rr, _ = sessionRequest(webapp, "GET", nil, cookie)
+        if rr.Body.String() != "bar" {
+            t.Errorf("%s: session value is `%s`", name, rr.Body.String())
+        }
+
+        rr, _ = sessionRequest(webapp, "DELETE", nil, cookie)
+        if rr.Code != http.StatusUnauthorized {
+            t.Errorf("%s: response code is %d", name, rr.Code)
+        }
+        _, loggedIn := sessionRequest(webapp, "POST", url.Values{"foo": {"baz"}, "login": {"bob"}}, cookie)
+        if loggedIn == nil || (name != "cookie" && loggedIn.Value == cookie.Value) {
+            t.Errorf("%s: session is not regenerated on login", name)
+        }
+        if name != "cookie" {
+            rr, _ = sessionRequest(webapp, "GET", nil, cookie)
+            if rr.Body.String() != "" {
+                t.Errorf("%s: old session value is `%s`", name, rr.Body.String())
+            }
+        }
+        rr, destroyed := sessionRequest(webapp, "DELETE", nil, loggedIn)
+        if rr.Body.String() != "bob" || destroyed == nil || destroyed.MaxAge != -1 {
+            t.Errorf("%s: delete returns `%s`, cookie %v", name, rr.Body.String(), destroyed)
+        }
+        if name != "cookie" {
+            rr, _ = sessionRequest(webapp, "GET", nil, loggedIn)
+            if rr.Body.String() != "" {
+                t.Errorf("%s: destroyed session value is `%s`", name, rr.Body.String())
+            }
+        }
+
+        // logging in after destroying the session starts a new one
+        _, loggedIn = sessionRequest(webapp, "POST", url.Values{"login": {"bob"}}, nil)
+        rr, relogged := sessionRequest(webapp, "DELETE", url.Values{"login": {"carol"}}, loggedIn)
+        if rr.Body.String() != "bob" || relogged == nil || relogged.MaxAge <= 0 {
+            t.Fatalf("%s: relogin returns `%s`, cookie %v", name, rr.Body.String(), relogged)
+        }
+        rr, _ = sessionRequest(webapp, "DELETE", nil, relogged)
+        if rr.Body.String() != "carol" {
+            t.Errorf("%s: user after relogin is `%s`", name, rr.Body.String())
+        }
+    }
+}
+
+type countingStore struct {
+    SessionStore
+    loads int
+}
+
+func (c *countingStore) Load(key string) ([]byte, error) {
+    c.loads++
+    return c.SessionStore.Load(key)
+}
+
+func TestSessionLoadedOnce(t *testing.T) {
+    webapp := CreateWebApp([]RouteRule{
+        {"/session", SessionTest{}},
+    })
+    store := &countingStore{SessionStore: CreateMemoryStore()}
+    webapp.Sessions = CreateSessionManager(store)
+    webapp.UserProvider = &SessionUserProvider{webapp.Sessions}
+
+    _, cookie := sessionRequest(webapp, "POST", url.Values{"foo": {"bar"}, "login": {"bob"}}, nil)
+    store.loads = 0
+    rr, _ := sessionRequest(webapp, "GET", nil, cookie)
+    if rr.Body.String() != "bar" || store.loads != 1 {
+        t.Errorf("session value is `%s`, loaded %d times", rr.Body.String(), store.loads)
+    }
+}
+
+func TestSessionExpiry(t *testing.T) {
+    webapp := CreateWebApp([]RouteRule{
+        {"/session", SessionTest{}},
+    })
+    webapp.Sessions = CreateSessionManager(CreateMemoryStore())
+    webapp.Sessions.IdleTimeout = time.Second
+
+    _, cookie := sessionRequest(webapp, "POST", url.Values{"foo": {"bar"}}, nil)
+    rr, touched := sessionRequest(webapp, "GET", nil, cookie)
+    if rr.Body.String() != "bar" || touched == nil {
+        t.Errorf("session value is `%s`, cookie %v", rr.Body.String(), touched)
+    }
+    time.Sleep(2100 * time.Millisecond)
+    rr, _ = sessionRequest(webapp, "GET", nil, cookie)
+    if rr.Body.String() != "" {
+        t.Errorf("idle session value is `%s`", rr.Body.String())
+    }
+}
+
+func TestCookieStoreTampered(t *testing.T) {
+    store := CreateCookieStore("new secret", "old secret")
+    value, _ := CreateCookieStore("old secret").Save("", []byte("data"), 0)
+    data, err := store.Load(value)
+    if string(data) != "data" || err != nil {
+        t.Errorf("data is `%s`, error %s", data, err)
+    }
+    tampered := []byte(value)
+    tampered[len(tampered)/2] ^= 1
+    _, err = store.Load(string(tampered))
+    if err == nil {
+        t.Errorf("tampered cookie is accepted")
+    }
+    _, err = CreateCookieStore("other").Load(value)
+    if err == nil {
+        t.Errorf("cookie of another secret is accepted")
+    }
+}
+
+func TestFileStoreExpiry(t *testing.T) {
+    dir, _ := ioutil.TempDir("", "vitali-session-")
+    defer os.RemoveAll(dir)
+    store, _ := CreateFileStore(dir)
+
+    key, err := store.Save("", []byte("data"), time.Hour)
+    data, _ := store.Load(key)
+    if err != nil || string(data) != "data" {
+        t.Errorf("data is `%s`, error %s", data, err)
+    }
+    expired := newSessionID()
+    ioutil.WriteFile(dir+"/"+expired, []byte("1\ndata"), 0600)
+    data, err = store.Load(expired)
+    if data != nil || err != nil {
+        t.Errorf("expired data is `%s`, error %s", data, err)
+    }
+    if _, err := os.Stat(dir+"/"+expired); !os.IsNotExist(err) {
+        t.Errorf("expired session is not removed by Load")
+    }
+
+    ioutil.WriteFile(dir+"/"+expired, []byte("1\ndata"), 0600)
+    store.Sweep()
+    if _, err := os.Stat(dir+"/"+expired); !os.IsNotExist(err) {
+        t.Errorf("expired session is not swept")
+    }
+    if _, err := os.Stat(dir+"/"+key); err != nil {
+        t.Errorf("live session is swept")
+    }
+}
+
+func TestSessionsNotSet(t *testing.T) {
+    webapp := CreateWebApp([]RouteRule{
+        {"/session", SessionTest{}},
+    })
+    rr, _ := sessionRequest(webapp, "GET", nil, nil)
+    if rr.Code != http.StatusInternalServerError {
+        t.Errorf("response code is %d", rr.Code)
+    }
+}
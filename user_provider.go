@@ -1,6 +1,7 @@
 package vitali
 
 import (
+    "strings"
     "net/http"
 )
 
@@ -19,3 +20,88 @@ func (c EmptyUserProvider) AuthHeader(r *http.Request) string {
 func (c EmptyUserProvider) GetUserAndRoles(r *http.Request) (string, []string) {
     return "", []string{""}
 }
+
+// AuthSchemer is implemented by the UserProviders which tell the scheme which
+// authenticated the request, like "Basic", set to Ctx.AuthScheme.
+type AuthSchemer interface {
+    AuthScheme() string
+}
+
+// ChainedUserProvider tries the Providers in order, and the first one
+// authenticating the request wins. The 401 responses carry the challenges of
+// all of them, so that both the browsers and the API clients are prompted.
+type ChainedUserProvider struct {
+    Providers []UserProvider
+}
+
+func CreateChainedUserProvider(providers ...UserProvider) *ChainedUserProvider {
+    return &ChainedUserProvider{providers}
+}
+
+// Authenticate returns the user, roles and scheme of the first provider
+// authenticating the request.
+func (c *ChainedUserProvider) Authenticate(r *http.Request) (string, []string, string) {
+    for _, provider := range c.Providers {
+        user, roles, scheme := authenticate(provider, r)
+        if user != "" {
+            return user, roles, scheme
+        }
+    }
+    return "", []string{}, ""
+}
+
+func (c *ChainedUserProvider) GetUserAndRoles(r *http.Request) (string, []string) {
+    user, roles, _ := c.Authenticate(r)
+    return user, roles
+}
+
+// AuthHeaders returns the non-empty challenges of the providers, each of
+// which is sent in its own WWW-Authenticate header.
+func (c *ChainedUserProvider) AuthHeaders(r *http.Request) []string {
+    challenges := []string{}
+    for _, provider := range c.Providers {
+        challenges = append(challenges, authHeaders(provider, r)...)
+    }
+    return challenges
+}
+
+func (c *ChainedUserProvider) AuthHeader(r *http.Request) string {
+    return strings.Join(c.AuthHeaders(r), ", ")
+}
+
+func authenticate(provider UserProvider, r *http.Request) (user string, roles []string, scheme string) {
+    if chained, ok := provider.(*ChainedUserProvider); ok {
+        return chained.Authenticate(r)
+    }
+    user, roles = provider.GetUserAndRoles(r)
+    if schemer, ok := provider.(AuthSchemer); ok && user != "" {
+        scheme = schemer.AuthScheme()
+    }
+    return
+}
+
+func authHeaders(provider UserProvider, r *http.Request) []string {
+    if chained, ok := provider.(*ChainedUserProvider); ok {
+        return chained.AuthHeaders(r)
+    }
+    challenge := provider.AuthHeader(r)
+    if challenge == "" {
+        return []string{}
+    }
+    return []string{challenge}
+}
+
+// setProviderLogger passes the Logger of the webapp to the providers logging
+// in the background, like the htpasswd watcher.
+func setProviderLogger(provider UserProvider, logger Logger) {
+    switch v := provider.(type) {
+    case *ChainedUserProvider:
+        for _, p := range v.Providers {
+            setProviderLogger(p, logger)
+        }
+    case *HtpasswdUserProvider:
+        if v.logger != nil {
+            v.logger.set(logger)
+        }
+    }
+}
@@ -0,0 +1,93 @@
+package vitali
+
+import (
+    "os"
+    "time"
+    "testing"
+    "net/http"
+    "net/url"
+    "io/ioutil"
+    "path/filepath"
+    "net/http/httptest"
+)
+
+type SchemeTest struct {
+    Ctx
+    Perm `GET:"AUTHED"`
+}
+
+func (c SchemeTest) Get() interface{} {
+    return c.Username + " " + c.AuthScheme
+}
+
+func TestChainedUserProvider(t *testing.T) {
+    dir, _ := ioutil.TempDir("", "vitali-chained-")
+    defer os.RemoveAll(dir)
+    passwdFile := filepath.Join(dir, "htpasswd")
+    groupFile := filepath.Join(dir, "htgroup")
+    ioutil.WriteFile(passwdFile, []byte(testHtpasswd), 0600)
+    ioutil.WriteFile(groupFile, []byte(testHtgroup), 0600)
+    basic, err := CreateHtpasswdUserProvider("basic", passwdFile, groupFile)
+    if err != nil {
+        t.Fatalf("create error %s", err)
+    }
+    bearer := CreateBearerUserProvider("api")
+    bearer.AddHMACKey("", []byte("secret"))
+    sessions := CreateSessionManager(CreateMemoryStore())
+
+    webapp := CreateWebApp([]RouteRule{
+        {"/scheme", SchemeTest{}},
+    })
+    webapp.UserProvider = CreateChainedUserProvider(&SessionUserProvider{sessions}, bearer, basic)
+
+    token := signTestToken(map[string]interface{}{"alg": "HS256"},
+        map[string]interface{}{"sub": "eve", "roles": "AUTHED", "exp": time.Now().Unix() + 60},
+        hs256("secret"))
+    tests := []struct {
+        authHeader string
+        code int
+        body string
+        challenges []string
+    }{
+        {basicAuth("alice", "bar"), http.StatusOK, "alice Basic", nil},
+        {"Bearer " + token, http.StatusOK, "eve Bearer", nil},
+        {"", http.StatusUnauthorized, "", []string{
+            `Bearer realm="api"`,
+            `Basic realm="basic", charset="UTF-8"`,
+        }},
+        {"Bearer x.y.z", http.StatusUnauthorized, "", []string{
+            `Bearer realm="api", error="invalid_token", error_description="malformed token header"`,
+            `Basic realm="basic", charset="UTF-8"`,
+        }},
+    }
+    for i, test := range tests {
+        r := &http.Request{
+            Method: "GET",
+            URL: &url.URL{
+                Path: "/scheme",
+            },
+            Header: make(http.Header),
+        }
+        if test.authHeader != "" {
+            r.Header.Set("Authorization", test.authHeader)
+        }
+        rr := httptest.NewRecorder()
+        webapp.ServeHTTP(rr, r)
+        if rr.Code != test.code {
+            t.Errorf("#%d response code is %d", i, rr.Code)
+        }
+        if test.body != "" && rr.Body.String() != test.body {
+            t.Errorf("#%d entity is `%s`", i, rr.Body.String())
+        }
+        challenges := rr.Header()["Www-Authenticate"]
+        if len(challenges) != len(test.challenges) {
+            t.Errorf("#%d challenges are %q", i, challenges)
+            continue
+        }
+        for j, challenge := range challenges {
+            if challenge != test.challenges[j] {
+                t.Errorf("#%d challenge is `%s`", i, challenge)
+            }
+        }
+    }
+}
@@ -0,0 +1,102 @@
+package vitali
+
+import (
+    "io"
+    "time"
+    "regexp"
+    "strings"
+    "io/ioutil"
+    "path/filepath"
+    "html/template"
+)
+
+var viewLangRe = regexp.MustCompile("^[a-z]{2,3}(-[a-z0-9]{2,8})*$")
+
+// isViewLang tells if the infix of a view file is a language, which is shaped
+// like a BCP 47 tag and is a language in i18n or a prefix of one, e.g. zh for
+// zh-tw, if there are any.
+func isViewLang(lang string, i18n map[string]map[string]template.HTML) bool {
+    if !viewLangRe.MatchString(lang) {
+        return false
+    }
+    if len(i18n) == 0 {
+        return true
+    }
+    for l := range i18n {
+        if l == lang || strings.HasPrefix(l, lang+"-") {
+            return true
+        }
+    }
+    return false
+}
+
+// findViewVariants scans the views folder for language specific versions of
+// the templates, e.g. slide.zh-tw.html next to slide.html, and returns the
+// name of the template set to use for each language found. Other infixes,
+// like slide.print.html, are not languages.
+func findViewVariants(templatesName string, i18n map[string]map[string]template.HTML) map[string]string {
+    files, err := ioutil.ReadDir("views")
+    if err != nil {
+        return nil
+    }
+
+    names := strings.Split(templatesName, ",")
+    langFiles := make(map[string]map[string]string)
+    for _, f := range files {
+        for _, t := range names {
+            ext := filepath.Ext(t)
+            prefix := strings.TrimSuffix(t, ext) + "."
+            if !strings.HasPrefix(f.Name(), prefix) || !strings.HasSuffix(f.Name(), ext) {
+                continue
+            }
+            lang := strings.TrimSuffix(strings.TrimPrefix(f.Name(), prefix), ext)
+            lang = strings.ToLower(lang)
+            if !isViewLang(lang, i18n) {
+                continue
+            }
+            if langFiles[lang] == nil {
+                langFiles[lang] = make(map[string]string)
+            }
+            langFiles[lang][t] = f.Name()
+        }
+    }
+
+    variants := make(map[string]string)
+    for lang, replaced := range langFiles {
+        variant := make([]string, len(names))
+        for i, t := range names {
+            variant[i] = t
+            if name, ok := replaced[t]; ok {
+                variant[i] = name
+            }
+        }
+        variants[lang] = strings.Join(variant, ",")
+    }
+    return variants
+}
+
+// chooseView returns the template set for templateName that best matches
+// lang, falling back to the language neutral one.
+func (c *webApp) chooseView(templateName string, lang string) string {
+    variants := c.viewVariants[templateName]
+    if len(variants) == 0 {
+        return templateName
+    }
+    for _, l := range c.langFallbacks(lang) {
+        if variant, ok := variants[l]; ok {
+            return variant
+        }
+    }
+    return templateName
+}
+
+// executeView executes the template set with the data, recording the render
+// time in the Metrics.
+func (c *webApp) executeView(w io.Writer, templatesName string, data interface{}) error {
+    start := time.Now()
+    err := c.views[templatesName].Execute(w, data)
+    if c.Metrics != nil {
+        c.Metrics.render(templatesName, time.Since(start))
+    }
+    return err
+}
@@ -1,6 +1,7 @@
 package vitali
 
 import (
+    "fmt"
     "testing"
     "net/http"
     "net/url"
@@ -241,3 +242,126 @@ func TestViewWebappWithFunc(t *testing.T) {
         t.Errorf("entity is `%s`", entity)
     }
 }
+
+type ViewVariant struct {
+    Ctx
+    Provides `GET:"text/html"`
+    Views `GET:"base.html,variant_body.html"`
+}
+
+func (c *ViewVariant) Get() interface{} {
+    return "foo"
+}
+
+func TestViewVariant(t *testing.T) {
+    r := &http.Request{
+        Method: "GET",
+        Host:   "lunastorm.tw",
+        URL: &url.URL{
+            Path: "/viewvariant",
+        },
+        Header: make(http.Header),
+    }
+    r.Header.Set("Accept-Language", "zh-tw")
+
+    rr := httptest.NewRecorder()
+    webapp := CreateWebApp([]RouteRule{
+        {"/viewvariant", ViewVariant{}},
+    })
+    webapp.LangProvider = &TestLangProvider{}
+    webapp.ServeHTTP(rr, r)
+
+    if rr.Code != http.StatusOK {
+        t.Errorf("response code is %d", rr.Code)
+    }
+    entity := rr.Body.String()
+    if entity != "<html>中文 foo</html>\n" {
+        t.Errorf("entity is `%s`", entity)
+    }
+
+    r.Header.Set("Accept-Language", "en-us")
+    rr = httptest.NewRecorder()
+    webapp.ServeHTTP(rr, r)
+    entity = rr.Body.String()
+    if entity != "<html>default foo</html>\n" {
+        t.Errorf("entity is `%s`", entity)
+    }
+
+    webapp.Settings["DEFAULT_LANG"] = "zh"
+    rr = httptest.NewRecorder()
+    webapp.ServeHTTP(rr, r)
+    entity = rr.Body.String()
+    if entity != "<html>中文 foo</html>\n" {
+        t.Errorf("entity is `%s`", entity)
+    }
+
+    // variant_body.print.html is not a language variant
+    if variants := webapp.viewVariants["base.html,variant_body.html"]; len(variants) != 1 ||
+            variants["zh"] != "base.html,variant_body.zh.html" {
+        t.Errorf("variants are %v", variants)
+    }
+}
+
+type ErrorPageTest struct {
+    Ctx
+    Provides `GET:"text/html,application/json"`
+}
+
+func (c *ErrorPageTest) Get() interface{} {
+    if c.Param("panic") != "" {
+        panic("panic!!")
+    }
+    return c.Forbidden()
+}
+
+func TestErrorPage(t *testing.T) {
+    webapp := CreateWebApp([]RouteRule{
+        {"/errorpage", ErrorPageTest{}},
+    })
+    webapp.Settings["DEFAULT_LANG"] = "en-us"
+    webapp.ErrorPage("4xx", "error_page.html")
+    webapp.ErrorPage("500", "error_page.html")
+
+    request := func(path string, accept string) *httptest.ResponseRecorder {
+        r, _ := http.NewRequest("GET", "http://lunastorm.tw"+path, nil)
+        r.Header.Set("Accept", accept)
+        rr := httptest.NewRecorder()
+        webapp.ServeHTTP(rr, r)
+        return rr
+    }
+
+    rr := request("/errorpage", "text/html")
+    if rr.Code != http.StatusForbidden {
+        t.Errorf("response code is %d", rr.Code)
+    }
+    if entity := rr.Body.String(); entity != "<html>403 Forbidden hi</html>\n" {
+        t.Errorf("entity is `%s`", entity)
+    }
+
+    rr = request("/errorpage", "application/json")
+    if entity := rr.Body.String(); entity != "Forbidden\n" {
+        t.Errorf("entity is `%s`", entity)
+    }
+
+    rr = request("/nothing", "text/html,*/*;q=0.8")
+    if rr.Code != http.StatusNotFound {
+        t.Errorf("response code is %d", rr.Code)
+    }
+    if entity := rr.Body.String(); entity != "<html>404 Not Found hi</html>\n" {
+        t.Errorf("entity is `%s`", entity)
+    }
+
+    rr = request("/nothing", "*/*")
+    if entity := rr.Body.String(); entity != "Not Found\n" {
+        t.Errorf("entity is `%s`", entity)
+    }
+
+    rr = request("/errorpage?panic=1", "text/html")
+    if rr.Code != http.StatusInternalServerError {
+        t.Errorf("response code is %d", rr.Code)
+    }
+    expected := fmt.Sprintf("<html>500 Internal Server Error #%d hi</html>\n", errorCode("panic!!"))
+    if entity := rr.Body.String(); entity != expected {
+        t.Errorf("entity is `%s`", entity)
+    }
+}
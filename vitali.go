@@ -1,11 +1,10 @@
 package vitali
 
 import (
-    "log"
     "fmt"
+    "errors"
     "strconv"
     "net/http"
-    "encoding/json"
     "net/http/httputil"
     "io/ioutil"
     "html/template"
@@ -13,6 +12,8 @@ import (
     "regexp"
     "strings"
     "reflect"
+    "sort"
+    "sync"
     "github.com/go-fsnotify/fsnotify"
 )
 
@@ -30,30 +31,37 @@ type webApp struct {
     RouteRules []RouteRule
     PatternMappings []PatternMapping
     UserProvider UserProvider
+    RoleHierarchy map[string][]string
+    Policies map[string]Policy
     LangProvider LangProvider
+    Sessions *SessionManager
+    CSRF *CSRFGuard
     Settings map[string]string
     DumpRequest bool
+    DevMode bool
+    LangPrefix bool
+    LangPrefixExclude []string
+    Methods map[string]string
+    MethodOverride []string
+    Logger Logger
+    AccessLogLevel Level
+    AccessLog *AccessLog
+    Metrics *Metrics
+    TrustedProxies []string
+    ErrorMappers []ErrorMapper
+    ProblemDetails bool
     ErrTemplate *template.Template
     I18n map[string]map[string]template.HTML
+    Catalog *Catalog
+    perms map[string]permExpr
+    missingReported *sync.Map
     views map[string]*template.Template
+    viewVariants map[string]map[string]string
+    errorPages map[string]string
+    funcMap template.FuncMap
     viewWatcher *fsnotify.Watcher
-}
-
-func checkPermission(perm reflect.StructTag, method Method, roles Roles) bool {
-    requiredRole := perm.Get(string(method))
-    if requiredRole == "" {
-        requiredRole = perm.Get("*")
-    }
-    if requiredRole == "" {
-        return true
-    }
-    for _, r := range(strings.Split(requiredRole, "|")) {
-        _, exists := roles[r]
-        if exists {
-            return true
-        }
-    }
-    return false
+    watcherLogger *sharedLogger
+    labelCache *labelCache
 }
 
 func checkMediaType(consumes reflect.StructTag, method Method, mediaType MediaType) bool {
@@ -79,31 +87,31 @@ func chooseType(provided MediaTypes, acceptHeader string) MediaType {
         acceptHeader = "*/*"
     }
 
-    typeAndParams := strings.Split(acceptHeader, ",")
-    typeWithPriorities := make([]typeWithPriority, len(typeAndParams))
-    for i, tpstr := range(typeAndParams) {
+    typeWithPriorities := []typeWithPriority{}
+    for _, tpstr := range(strings.Split(acceptHeader, ",")) {
         tppair := strings.Split(tpstr, ";")
-        var q float64
-        if len(tppair) == 1 {
-            q = 1.0
-        } else {
-            q, _ = strconv.ParseFloat(strings.TrimSpace(tppair[1])[2:], 32)
-        }
-        j := 0
-        for ; j<i ; j++ {
-            if q > typeWithPriorities[j].q {
-                break
+        q := 1.0
+        for _, param := range tppair[1:] {
+            param = strings.TrimSpace(param)
+            if strings.HasPrefix(param, "q=") {
+                q, _ = strconv.ParseFloat(param[2:], 32)
             }
         }
-        typeWithPriorities = append(typeWithPriorities[:j],
-            append([]typeWithPriority{typeWithPriority{strings.TrimSpace(tppair[0]), q}},
-                typeWithPriorities[j:]...)...)[:len(typeAndParams)]
+        // q=0 means not acceptable
+        if q <= 0 {
+            continue
+        }
+        typeWithPriorities = append(typeWithPriorities,
+            typeWithPriority{strings.TrimSpace(tppair[0]), q})
     }
+    sort.SliceStable(typeWithPriorities, func(i, j int) bool {
+        return typeWithPriorities[i].q > typeWithPriorities[j].q
+    })
 
     for _, t := range(typeWithPriorities) {
         for _, p := range(provided) {
             matched, _ := regexp.MatchString(fmt.Sprintf("^%s$",
-                strings.Replace(t.t, "*", "[^/]+", -1)), string(p))
+                strings.Replace(regexp.QuoteMeta(t.t), `\*`, "[^/]+", -1)), string(p))
             if matched {
                 return p
             }
@@ -113,8 +121,43 @@ func chooseType(provided MediaTypes, acceptHeader string) MediaType {
 }
 
 func (c webApp) matchRules(w *wrappedWriter, r *http.Request) (result interface{}, ctx Ctx, viewName string) {
+    // the panics before the handler, like in Pre or the providers
+    defer func() {
+        if r := recover(); r != nil {
+            rstr := fmt.Sprintf("%s", r)
+            err, _ := r.(error)
+            result = internalError {
+                where: lineInfo(3),
+                why: rstr + fullTrace(5, "\n\t"),
+                code: errorCode(rstr),
+                err: err,
+                panicked: true,
+            }
+        }
+    }()
+
+    if err := c.Validate(); err != nil {
+        result = internalError{why: err.Error(), code: errorCode(err.Error())}
+        return
+    }
+
+    path := r.URL.Path
+    var pathLang string
+    if c.LangPrefix {
+        pathLang, path = c.splitLangPrefix(path)
+        if pathLang == "" && (r.Method == "GET" || r.Method == "HEAD") && c.langRedirected(path) {
+            ctx = Ctx{Request: r, ResponseWriter: w, RequestID: w.requestID, app: &c}
+            if uri := c.langRedirect(&ctx); uri != "" {
+                result = found{uri}
+                return
+            }
+        }
+    }
+
+    slot := &sessionSlot{sessions: c.Sessions}
+    r = withSessionSlot(r, slot)
     for i, routeRule := range c.RouteRules {
-        params := c.PatternMappings[i].Re.FindStringSubmatch(r.URL.Path)
+        params := c.PatternMappings[i].Re.FindStringSubmatch(path)
         if params != nil {
             pathParams := make(map[string]string)
             if len(params) > 1 {
@@ -123,19 +166,32 @@ func (c webApp) matchRules(w *wrappedWriter, r *http.Request) (result interface{
                 }
             }
 
-            user, roles := c.UserProvider.GetUserAndRoles(r)
+            user, roles, scheme := authenticate(c.UserProvider, r)
             ctx.pathParams = pathParams
+            ctx.route = routeRule.Pattern
             ctx.Username = user
+            ctx.AuthScheme = scheme
             ctx.Roles = make(Roles)
             ctx.Request = r
             ctx.ResponseWriter = w
+            ctx.RequestID = w.requestID
+            ctx.app = &c
+            ctx.pathLang = pathLang
+            ctx.session = slot
             for _, role := range roles {
                 ctx.Roles[role] = struct{}{}
             }
             if ctx.Username != "" {
                 ctx.Roles["_AUTHED"] = struct{}{}
             }
-            ctx.ChosenLang = c.LangProvider.Select(&ctx)
+            c.impliedRoles(ctx.Roles)
+            if pathLang != "" {
+                // the prefix wins over the other sources of the provider
+                ctx.ChosenLang = pathLang
+                w.Header().Set("Content-Language", pathLang)
+            } else {
+                ctx.ChosenLang = c.LangProvider.Select(&ctx)
+            }
 
             contentType := r.Header.Get("Content-Type")
             if contentType != "" {
@@ -147,7 +203,7 @@ func (c webApp) matchRules(w *wrappedWriter, r *http.Request) (result interface{
             if found {
                 providedStr := tProvides.Tag.Get(r.Method)
                 if providedStr != "" {
-                    w.Header().Set("Vary", "Accept")
+                    w.Header().Add("Vary", "Accept")
                     providedTmp := strings.Split(providedStr, ",")
                     provided := make(MediaTypes, len(providedTmp))
                     for i, v := range providedTmp {
@@ -166,6 +222,8 @@ func (c webApp) matchRules(w *wrappedWriter, r *http.Request) (result interface{
             vNewResourcePtr := reflect.New(reflect.TypeOf(routeRule.Resource))
             vNewResource := vNewResourcePtr.Elem()
             var PermTag reflect.StructTag
+            var CSRFTag reflect.StructTag
+            resourceCtx := &ctx
             for i := 0; i < vResource.NumField(); i++ {
                 srcField := vResource.Field(i)
                 newField := vNewResource.Field(i)
@@ -173,8 +231,11 @@ func (c webApp) matchRules(w *wrappedWriter, r *http.Request) (result interface{
                 switch reflect.TypeOf(srcField.Interface()).Name() {
                 case "Ctx":
                     newField.Set(reflect.ValueOf(ctx))
+                    resourceCtx = newField.Addr().Interface().(*Ctx)
                 case "Perm":
                     PermTag = vResource.Type().Field(i).Tag
+                case "CSRF":
+                    CSRFTag = vResource.Type().Field(i).Tag
                 case "Consumes":
                     if !checkMediaType(vResource.Type().Field(i).Tag, Method(r.Method),
                             MediaType(ctx.ContentType)) {
@@ -196,10 +257,10 @@ func (c webApp) matchRules(w *wrappedWriter, r *http.Request) (result interface{
                 }
             }
             if PermTag != "" {
-               if !checkPermission(PermTag, Method(r.Method),
-                       ctx.Roles) {
+               if !c.checkPermission(PermTag, Method(r.Method),
+                       resourceCtx) {
                    if user == "" {
-                       result = unauthorized{wwwAuthHeader: c.UserProvider.AuthHeader(r)}
+                       result = unauthorized{wwwAuthHeaders: authHeaders(c.UserProvider, r)}
                    } else {
                        result = forbidden{}
                    }
@@ -207,7 +268,15 @@ func (c webApp) matchRules(w *wrappedWriter, r *http.Request) (result interface{
                }
             }
 
-            result = getResult(r.Method, &vNewResourcePtr)
+            // after the permissions, so that the users not logged in get 401
+            if c.CSRF != nil && !isSafeMethod(r.Method) && tagValue(CSRFTag, r.Method) != "exempt" {
+                if reason := c.CSRF.check(resourceCtx); reason != "" {
+                    result = forbidden{reason: reason}
+                    return
+                }
+            }
+
+            result = c.getResult(r.Method, &vNewResourcePtr)
             return
         }
     }
@@ -215,75 +284,217 @@ func (c webApp) matchRules(w *wrappedWriter, r *http.Request) (result interface{
     return
 }
 
-func getAllowed(vResourcePtr *reflect.Value) (allowed []string) {
+// the methods of Ctx are promoted to the resources, but they are not handlers
+func isCtxMethod(name string) bool {
+    _, found := reflect.TypeOf(&Ctx{}).MethodByName(name)
+    return found
+}
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// isHandler tells if the method is a handler, which takes no arguments and
+// returns interface{}, (T, error) or error.
+func isHandler(tMethod reflect.Type) bool {
+    if tMethod.NumIn() != 0 {
+        return false
+    }
+    switch tMethod.NumOut() {
+    case 1:
+        return tMethod.Out(0).Name() == "" || tMethod.Out(0) == errorType
+    case 2:
+        return tMethod.Out(1) == errorType
+    }
+    return false
+}
+
+// handlerResult returns the error returned by a handler if it is not nil,
+// or else the model, or 204 if there is no model.
+func handlerResult(out []reflect.Value) interface{} {
+    last := out[len(out)-1]
+    if last.Type() != errorType {
+        return last.Interface()
+    }
+    if !last.IsNil() {
+        return last.Interface()
+    }
+    if len(out) == 1 {
+        return noContent{}
+    }
+    model := out[0]
+    if (model.Kind() == reflect.Ptr || model.Kind() == reflect.Interface) && model.IsNil() {
+        return noContent{}
+    }
+    return model.Interface()
+}
+
+// DefaultMethods maps the HTTP methods to the names of their handlers, and
+// is copied to the Methods of the webapp when it is created.
+var DefaultMethods = map[string]string{
+    "GET": "Get",
+    "HEAD": "Get",
+    "POST": "Post",
+    "PUT": "Put",
+    "PATCH": "Patch",
+    "DELETE": "Delete",
+    "OPTIONS": "Options",
+    "PROPFIND": "Propfind",
+    "PROPPATCH": "Proppatch",
+    "MKCOL": "Mkcol",
+    "COPY": "Copy",
+    "MOVE": "Move",
+    "LOCK": "Lock",
+    "UNLOCK": "Unlock",
+}
+
+// handlerName returns the name of the handler of the HTTP method, or "" if
+// the method is not in Methods.
+func (c webApp) handlerName(method string) string {
+    return c.Methods[method]
+}
+
+func (c webApp) getAllowed(vResourcePtr *reflect.Value) (allowed []string) {
+    verbs := make(map[string][]string)
+    for method, name := range c.Methods {
+        verbs[name] = append(verbs[name], method)
+    }
     for i:=0; i<vResourcePtr.NumMethod(); i++ {
         method := vResourcePtr.Type().Method(i)
-        if method.PkgPath == "" && method.Type.NumIn()==1 && method.Type.NumOut()==1 &&
-                method.Type.Out(0).Name() == "" && method.Name != "Pre"{
-            if method.Name == "Get" {
-                allowed = append(allowed, "HEAD")
-                allowed = append(allowed, "GET")
-            } else {
-                allowed = append(allowed, strings.ToUpper(method.Name))
-            }
+        if method.PkgPath == "" && isHandler(vResourcePtr.Method(i).Type()) &&
+                method.Name != "Pre" && !isCtxMethod(method.Name) {
+            methods := verbs[method.Name]
+            sort.Slice(methods, func(i, j int) bool {
+                return methods[i] == "HEAD" || (methods[j] != "HEAD" && methods[i] < methods[j])
+            })
+            allowed = append(allowed, methods...)
         }
     }
     return
 }
 
-func getResult(method string, vResourcePtr *reflect.Value) (result interface{}) {
+func (c webApp) getResult(method string, vResourcePtr *reflect.Value) (result interface{}) {
     defer func() {
         if r := recover(); r != nil {
             rstr := fmt.Sprintf("%s", r)
+            err, _ := r.(error)
             result = internalError {
                 where: lineInfo(3),
                 why: rstr + fullTrace(5, "\n\t"),
                 code: errorCode(rstr),
+                err: err,
+                panicked: true,
             }
         }
     }()
 
-    methodName := strings.Title(strings.ToLower(method))
-    if methodName == "Head"{
-        methodName = "Get"
+    methodName := c.handlerName(method)
+    if methodName == "" {
+        return methodNotAllowed{c.getAllowed(vResourcePtr)}
     }
     vMethod := vResourcePtr.MethodByName(methodName)
-    if vMethod.IsValid() {
-        result = vMethod.Call([]reflect.Value{})[0].Interface()
+    if vMethod.IsValid() && !isCtxMethod(methodName) && isHandler(vMethod.Type()) {
+        result = handlerResult(vMethod.Call([]reflect.Value{}))
     }
 
     if result == nil {
-        return methodNotAllowed{getAllowed(vResourcePtr)}
+        return methodNotAllowed{c.getAllowed(vResourcePtr)}
     }
     return
 }
 
-func (c webApp) logRequest(w *wrappedWriter, r *http.Request, elapsedMs float64,
+// logRequest writes the access record of the request to the AccessLog, or
+// logs it at AccessLogLevel. Internal errors are logged at LevelError.
+func (c webApp) logRequest(w *wrappedWriter, r *http.Request, ctx *Ctx, elapsed time.Duration,
         result interface{}) {
-    remoteAddr := r.Header.Get("X-Forwarded-For")
-    if remoteAddr == "" {
-        remoteAddr = r.RemoteAddr
+    record := &AccessRecord{
+        Time: w.inTime,
+        RemoteAddr: c.clientAddr(r),
+        Method: r.Method,
+        Path: r.URL.Path,
+        RequestURI: r.RequestURI,
+        Proto: r.Proto,
+        Route: ctx.route,
+        Status: w.status,
+        Bytes: w.written,
+        Duration: elapsed,
+        User: ctx.Username,
+        RequestID: w.requestID,
+        Referer: r.Referer(),
+        UserAgent: r.UserAgent(),
+        Code: w.err.code,
+        Error: w.err.why,
+    }
+    if record.RequestURI == "" {
+        record.RequestURI = r.URL.RequestURI()
+    }
+
+    level := c.AccessLogLevel
+    msg := "request"
+    fields := []interface{}{
+        "method", record.Method,
+        "path", record.Path,
+        "route", record.Route,
+        "status", record.Status,
+        "bytes", record.Bytes,
+        "duration", record.Duration,
+        "user", record.User,
+        "remote", record.RemoteAddr,
     }
     if w.status == 0 {
-        log.Printf("%s %s %s Client Disconnected (%.2f ms)", remoteAddr, r.Method,
-            r.URL.Path, elapsedMs)
-    } else {
-        errMsg := ""
-        if w.err.why != "" {
-            errMsg = fmt.Sprintf("%s #%d %s ", w.err.where, w.err.code, w.err.why)
+        msg = "client disconnected"
+    }
+    if w.err.why != "" {
+        level = LevelError
+        fields = append(fields, "code", w.err.code, "where", w.err.where, "error", w.err.why)
+    }
+    switch v := result.(type) {
+    case unsupportedMediaType:
+        fields = append(fields, "reason", r.Header.Get("Content-Type"))
+    case forbidden:
+        if v.reason != "" {
+            fields = append(fields, "reason", v.reason)
         }
-        switch result.(type) {
-        case unsupportedMediaType:
-            errMsg = fmt.Sprintf(": %s ", r.Header.Get("Content-Type"))
+    }
+
+    logger := c.requestLogger(w.requestID)
+    if c.AccessLog != nil {
+        err := c.AccessLog.write(record)
+        if err != nil {
+            logger.Log(LevelError, "failed to write access log", "error", err)
+        }
+        if level == LevelError {
+            logger.Log(level, "internal error", fields...)
         }
-        log.Printf("%s %s %s %s %s(%.2f ms, %d bytes)", remoteAddr, r.Method, r.URL.Path,
-            http.StatusText(w.status), errMsg, elapsedMs, w.written)
+    } else {
+        logger.Log(level, msg, fields...)
+    }
 
-        if c.DumpRequest {
-            dump, _ := httputil.DumpRequest(r, false)
-            log.Printf("%s", dump)
+    if c.DumpRequest {
+        dump, _ := httputil.DumpRequest(r, false)
+        logger.Log(c.AccessLogLevel, "request dump", "dump", string(dump))
+    }
+}
+
+// overrideMethod returns a shallow copy of a POST request with the method
+// replaced by the X-HTTP-Method-Override header or the _method form field, if
+// the method is in MethodOverride, or else the request itself. The methods
+// are compared case-insensitively.
+func (c webApp) overrideMethod(r *http.Request) *http.Request {
+    if r.Method != "POST" || len(c.MethodOverride) == 0 {
+        return r
+    }
+    method := r.Header.Get("X-HTTP-Method-Override")
+    if method == "" {
+        method = r.PostFormValue("_method")
+    }
+    method = strings.ToUpper(strings.TrimSpace(method))
+    for _, allowed := range c.MethodOverride {
+        if method != "" && method == strings.ToUpper(strings.TrimSpace(allowed)) {
+            overridden := r.WithContext(r.Context())
+            overridden.Method = method
+            return overridden
         }
     }
+    return r
 }
 
 func (c webApp) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -291,34 +502,81 @@ func (c webApp) ServeHTTP(w http.ResponseWriter, r *http.Request) {
         status: 0,
         writer: w,
         inTime: time.Now(),
+        requestID: c.requestID(r),
+    }
+    w.Header().Set(RequestIDHeader, ww.requestID)
+    c.propagateLogger()
+    var ctx Ctx
+    if c.Metrics != nil {
+        c.Metrics.begin()
+        // ended even if a panic escapes, not to leave the request in flight
+        defer func() {
+            method := r.Method
+            if _, ok := c.Methods[method]; !ok {
+                method = "OTHER"
+            }
+            c.Metrics.end(ctx.route, method, ww.status, ww.written, time.Since(ww.inTime))
+        }()
     }
     r.ParseForm()
+    r = c.overrideMethod(r)
     result, ctx, templateName := c.matchRules(ww, r)
+    ctx.RequestID = ww.requestID
+    switch v := result.(type) {
+    case error:
+        result = c.errorResponse(&ctx, v)
+    case internalError:
+        if v.panicked && c.Metrics != nil {
+            c.Metrics.panicked(ctx.route)
+        }
+        if v.err != nil {
+            if response := c.mapError(&ctx, v.err); response != nil {
+                result = response
+            }
+        }
+    }
+    c.saveSession(ww, &ctx)
     c.writeResponse(ww, r, &result, &ctx, templateName)
 
-    elapsedMs := float64(time.Now().UnixNano() - ww.inTime.UnixNano()) / 1000000
-    c.logRequest(ww, r, elapsedMs, result)
+    c.logRequest(ww, r, &ctx, time.Since(ww.inTime), result)
+}
+
+// Validate returns the error in the settings of the webapp, like
+// CSRFSynchronizer without Sessions or an invalid AccessLog format. Every
+// request is answered by 500 while it fails, so it can be called before
+// serving to fail early.
+func (c webApp) Validate() error {
+    if c.CSRF != nil && c.CSRF.Mode == CSRFSynchronizer && c.Sessions == nil {
+        return errors.New("vitali: CSRFSynchronizer needs webapp.Sessions")
+    }
+    if c.AccessLog != nil {
+        if _, err := c.AccessLog.template(); err != nil {
+            return fmt.Errorf("vitali: invalid AccessLog.Format: %v", err)
+        }
+    }
+    return nil
 }
 
 func CreateWebApp(rules []RouteRule) webApp {
     return CreateWebAppWithFuncmap(rules, template.FuncMap{})
 }
 
-func updateTemplate(templatesName string, views map[string]*template.Template, funcMap template.FuncMap) {
+func updateTemplate(templatesName string, views map[string]*template.Template, funcMap template.FuncMap,
+        logger Logger) {
     temp := template.New(templatesName).Funcs(funcMap)
     for _, t := range(strings.Split(templatesName, ",")) {
         path := fmt.Sprintf("./views/%s", t)
         content := panicOnErr(ioutil.ReadFile(path)).([]uint8)
         _, err := temp.Parse(string(content))
         if err != nil {
-            log.Printf("failed to parse template %s: %s\n", t, err)
+            logger.Log(LevelError, "failed to parse template", "template", t, "error", err)
             break
         }
     }
     views[templatesName] = temp
 }
 
-func runViewWatcher(views map[string]*template.Template, funcMap template.FuncMap) {
+func runViewWatcher(views map[string]*template.Template, funcMap template.FuncMap, logger Logger) {
     viewWatcher, err := fsnotify.NewWatcher()
     if err != nil { panic(err) }
 
@@ -334,13 +592,13 @@ func runViewWatcher(views map[string]*template.Template, funcMap template.FuncMa
                 for templatesName, _ := range views {
                     for _, name := range strings.Split(templatesName, ",") {
                         if name == filename {
-                            updateTemplate(templatesName, views, funcMap)
+                            updateTemplate(templatesName, views, funcMap, logger)
                             break
                         }
                     }
                 }
             case err := <-viewWatcher.Errors:
-                log.Printf("view watcher error: %s\n", err)
+                logger.Log(LevelError, "view watcher error", "error", err)
             }
         }
     }()
@@ -349,7 +607,15 @@ func runViewWatcher(views map[string]*template.Template, funcMap template.FuncMa
 func CreateWebAppWithFuncmap(rules []RouteRule, funcMap template.FuncMap) webApp {
     patternMappings := make([]PatternMapping, len(rules))
     views := make(map[string]*template.Template)
-    runViewWatcher(views, funcMap)
+    viewVariants := make(map[string]map[string]string)
+    perms := make(map[string]permExpr)
+    methods := make(map[string]string)
+    for method, name := range DefaultMethods {
+        methods[method] = name
+    }
+    watcherLogger := newSharedLogger(DefaultLogger)
+    runViewWatcher(views, funcMap, watcherLogger)
+    i18n := loadI18n("views")
 
     for i, v := range rules {
         re := regexp.MustCompile("/{[^}]*}")
@@ -363,6 +629,14 @@ func CreateWebAppWithFuncmap(rules []RouteRule, funcMap template.FuncMap) webApp
         }
         patternMappings[i] = PatternMapping{regexp.MustCompile("^"+transformedPattern+"/?$"), names}
 
+        tPerm, ok := reflect.TypeOf(v.Resource).FieldByName("Perm")
+        if ok {
+            err := parsePermTag(tPerm.Tag, perms)
+            if err != nil {
+                panic(fmt.Sprintf("invalid Perm tag of %s: %s", v.Pattern, err))
+            }
+        }
+
         funcMap["seq"] = Seq
         tViews, ok := reflect.TypeOf(v.Resource).FieldByName("Views")
         if ok {
@@ -370,14 +644,17 @@ func CreateWebAppWithFuncmap(rules []RouteRule, funcMap template.FuncMap) webApp
                 vStr := strings.Split(kv, ":")[1]
                 templatesName := vStr[1:len(vStr)-1]
 
-                updateTemplate(templatesName, views, funcMap)
+                updateTemplate(templatesName, views, funcMap, DefaultLogger)
+                viewVariants[templatesName] = findViewVariants(templatesName, i18n)
+                for _, variant := range viewVariants[templatesName] {
+                    updateTemplate(variant, views, funcMap, DefaultLogger)
+                }
             }
         }
     }
-    i18n := make(map[string]map[string]template.HTML)
-    content, err := ioutil.ReadFile("views/i18n.json")
-    if err == nil {
-        err = json.Unmarshal(content, &i18n)
+    for lang, keys := range MissingTranslations(i18n) {
+        DefaultLogger.Log(LevelWarn, "i18n keys missing", "lang", lang, "count", len(keys),
+            "keys", strings.Join(keys, ", "))
     }
 
     return webApp{
@@ -385,9 +662,22 @@ func CreateWebAppWithFuncmap(rules []RouteRule, funcMap template.FuncMap) webApp
         PatternMappings: patternMappings,
         UserProvider: EmptyUserProvider{},
         LangProvider: &EmptyLangProvider{},
+        Policies: map[string]Policy{
+            "ownerOf": OwnerOf,
+        },
         Settings: make(map[string]string),
+        Methods: methods,
+        Logger: DefaultLogger,
         I18n: i18n,
+        Catalog: NewCatalog(i18n),
+        perms: perms,
+        missingReported: &sync.Map{},
         views: views,
+        viewVariants: viewVariants,
+        errorPages: make(map[string]string),
+        funcMap: funcMap,
+        watcherLogger: watcherLogger,
+        labelCache: &labelCache{},
     }
 }
 
@@ -11,6 +11,7 @@ type wrappedWriter struct {
     inTime time.Time
     written int
     err internalError
+    requestID string
 }
 
 func (c *wrappedWriter) Header() http.Header {
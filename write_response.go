@@ -2,8 +2,6 @@ package vitali
 
 import (
     "io"
-    "os"
-    "log"
     "fmt"
     "strings"
     "net/http"
@@ -25,19 +23,60 @@ func (c *webApp) marshalOutput(w *wrappedWriter, model *interface{}, ctx *Ctx, t
             C *Ctx
             W *webApp
         }{
-            c.I18n[ctx.ChosenLang],
+            c.labels(ctx),
             model,
             ctx,
             c,
         }
-        c.views[templateName].Execute(w, m)
+        c.executeView(w, c.chooseView(templateName, ctx.ChosenLang), m)
     default:
         fmt.Fprintf(w, "%s", *model)
     }
 }
 
+// internalErrorText is the plain text body of 500, with the error code and the
+// request id to report.
+func internalErrorText(w *wrappedWriter) string {
+    return fmt.Sprintf("%s: %d (request id: %s)", http.StatusText(http.StatusInternalServerError),
+        w.err.code, w.requestID)
+}
+
+// writeError writes the error status with the body marshaled by the chosen
+// type, or the error page if there is no body.
+func (c *webApp) writeError(w *wrappedWriter, r *http.Request, code int, body interface{}, ctx *Ctx, templateName string) {
+    if body != nil {
+        w.WriteHeader(code)
+        c.marshalOutput(w, &body, ctx, templateName)
+    } else {
+        c.httpError(w, r, ctx, http.StatusText(code), ErrorDetails{Status: code})
+    }
+}
+
 func (c *webApp) writeResponse(w *wrappedWriter, r *http.Request, response *interface{}, ctx *Ctx, templateName string) {
+    if c.ProblemDetails {
+        mediaType := problemType(r.Header.Get("Accept"))
+        if mediaType != "" {
+            if problem := frameworkProblem(w, *response); problem != nil {
+                c.writeProblem(w, r, *problem, mediaType)
+                return
+            }
+        }
+    }
+
     switch v := (*response).(type) {
+    case problemDetails:
+        c.writeProblem(w, r, v.problem, problemType(r.Header.Get("Accept")))
+    case created:
+        w.Header().Set("Location", v.uri)
+        w.WriteHeader(http.StatusCreated)
+        if v.body != nil {
+            c.marshalOutput(w, &v.body, ctx, templateName)
+        }
+    case accepted:
+        w.WriteHeader(http.StatusAccepted)
+        if v.body != nil {
+            c.marshalOutput(w, &v.body, ctx, templateName)
+        }
     case noContent:
         w.WriteHeader(http.StatusNoContent)
     case movedPermanently:
@@ -55,63 +94,58 @@ func (c *webApp) writeResponse(w *wrappedWriter, r *http.Request, response *inte
     case tempRedirect:
         w.Header().Set("Location", v.uri)
         w.WriteHeader(http.StatusTemporaryRedirect)
+    case permanentRedirect:
+        w.Header().Set("Location", v.uri)
+        w.WriteHeader(http.StatusPermanentRedirect)
     case badRequest:
         if v.body != nil {
             w.WriteHeader(http.StatusBadRequest)
             c.marshalOutput(w, &v.body, ctx, templateName)
         } else {
-            http.Error(w, v.reason, http.StatusBadRequest)
+            c.httpError(w, r, ctx, v.reason, ErrorDetails{Status: http.StatusBadRequest,
+                Reason: v.reason})
         }
     case unauthorized:
-        w.Header()["WWW-Authenticate"] = []string{v.wwwAuthHeader}
-        if c.Settings["401_PAGE"] != "" && ctx.ChosenType == "text/html" {
-            w.Header().Set("Content-Type", "text/html")
-            w.WriteHeader(http.StatusUnauthorized)
-            f, err := os.Open(c.Settings["401_PAGE"])
-            if err != nil {
-                log.Printf("open 401 page error: %s\n", err)
-                return
+        if c.Settings["LOGIN_URL"] != "" && ctx.ChosenType == "text/html" {
+            w.Header().Set("Location", c.loginRedirect(r))
+            w.WriteHeader(http.StatusSeeOther)
+            return
+        }
+        for _, challenge := range v.wwwAuthHeaders {
+            if challenge != "" {
+                w.Header().Add("WWW-Authenticate", challenge)
             }
-            defer f.Close()
-            io.Copy(w, f)
+        }
+        if v.body != nil {
+            w.WriteHeader(http.StatusUnauthorized)
+            c.marshalOutput(w, &v.body, ctx, templateName)
         } else {
-            if v.body != nil {
-                w.WriteHeader(http.StatusUnauthorized)
-                c.marshalOutput(w, &v.body, ctx, templateName)
-            } else {
-                http.Error(w, "unauthorized", http.StatusUnauthorized)
-            }
+            c.httpError(w, r, ctx, "unauthorized", ErrorDetails{Status: http.StatusUnauthorized})
         }
     case forbidden:
-        if c.Settings["403_PAGE"] != "" && ctx.ChosenType == "text/html" {
-            w.Header().Set("Content-Type", "text/html")
+        if v.body != nil {
             w.WriteHeader(http.StatusForbidden)
-            f, err := os.Open(c.Settings["403_PAGE"])
-            if err != nil {
-                log.Printf("open 403 page error: %s\n", err)
-                return
-            }
-            defer f.Close()
-            io.Copy(w, f)
+            c.marshalOutput(w, &v.body, ctx, templateName)
         } else {
-            if v.body != nil {
-                w.WriteHeader(http.StatusForbidden)
-                c.marshalOutput(w, &v.body, ctx, templateName)
-            } else {
-                http.Error(w, "Forbidden", http.StatusForbidden)
+            msg := "Forbidden"
+            if v.reason != "" {
+                msg = "Forbidden: "+v.reason
             }
+            c.httpError(w, r, ctx, msg, ErrorDetails{Status: http.StatusForbidden,
+                Reason: v.reason})
         }
     case notFound:
         if v.body != nil {
             w.WriteHeader(http.StatusNotFound)
             c.marshalOutput(w, &v.body, ctx, templateName)
         } else {
-            http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+            c.httpError(w, r, ctx, http.StatusText(http.StatusNotFound),
+                ErrorDetails{Status: http.StatusNotFound})
         }
     case methodNotAllowed:
         w.Header().Set("Allow", strings.Join(v.allowed, ", "))
-        http.Error(w, http.StatusText(http.StatusMethodNotAllowed),
-            http.StatusMethodNotAllowed)
+        c.httpError(w, r, ctx, http.StatusText(http.StatusMethodNotAllowed),
+            ErrorDetails{Status: http.StatusMethodNotAllowed})
     case notAcceptable:
         w.Header().Set("Content-Type", "text/csv")
         types := make([]string, len(v.provided))
@@ -125,25 +159,60 @@ func (c *webApp) writeResponse(w *wrappedWriter, r *http.Request, response *inte
             w.WriteHeader(http.StatusUnsupportedMediaType)
             c.marshalOutput(w, &v.body, ctx, templateName)
         } else {
-            http.Error(w, http.StatusText(http.StatusUnsupportedMediaType),
-                http.StatusUnsupportedMediaType)
+            c.httpError(w, r, ctx, http.StatusText(http.StatusUnsupportedMediaType),
+                ErrorDetails{Status: http.StatusUnsupportedMediaType})
+        }
+    case conflict:
+        c.writeError(w, r, http.StatusConflict, v.body, ctx, templateName)
+    case gone:
+        c.writeError(w, r, http.StatusGone, v.body, ctx, templateName)
+    case preconditionFailed:
+        c.writeError(w, r, http.StatusPreconditionFailed, v.body, ctx, templateName)
+    case requestEntityTooLarge:
+        c.writeError(w, r, http.StatusRequestEntityTooLarge, v.body, ctx, templateName)
+    case unprocessableEntity:
+        c.writeError(w, r, http.StatusUnprocessableEntity, v.body, ctx, templateName)
+    case tooManyRequests:
+        if v.seconds >= 0 {
+            w.Header().Set("Retry-After", fmt.Sprintf("%d", v.seconds))
+        }
+        c.writeError(w, r, http.StatusTooManyRequests, v.body, ctx, templateName)
+    case badGateway:
+        c.writeError(w, r, http.StatusBadGateway, v.body, ctx, templateName)
+    case gatewayTimeout:
+        c.writeError(w, r, http.StatusGatewayTimeout, v.body, ctx, templateName)
+    case status:
+        for key, values := range v.headers {
+            for _, value := range values {
+                w.Header().Add(key, value)
+            }
+        }
+        w.WriteHeader(v.code)
+        if v.body != nil {
+            c.marshalOutput(w, &v.body, ctx, templateName)
         }
     case internalError:
         w.err = v
-        if c.ErrTemplate != nil {
+        if c.findErrorPage(http.StatusInternalServerError) != "" && acceptsHTML(r, ctx) {
+            c.httpError(w, r, ctx, "", ErrorDetails{Status: http.StatusInternalServerError,
+                Code: w.err.code})
+        } else if c.ErrTemplate != nil {
             w.WriteHeader(http.StatusInternalServerError)
-            md := struct {Code uint32}{w.err.code}
+            md := struct {
+                Code uint32
+                RequestID string
+            }{w.err.code, w.requestID}
             c.ErrTemplate.Execute(w, md)
         } else {
-            http.Error(w, fmt.Sprintf("%s: %d", http.StatusText(http.StatusInternalServerError),
-                w.err.code), http.StatusInternalServerError)
+            http.Error(w, internalErrorText(w), http.StatusInternalServerError)
         }
     case notImplemented:
         if v.body != nil {
             w.WriteHeader(http.StatusNotImplemented)
             c.marshalOutput(w, &v.body, ctx, templateName)
         } else {
-            http.Error(w, http.StatusText(http.StatusNotImplemented), http.StatusNotImplemented)
+            c.httpError(w, r, ctx, http.StatusText(http.StatusNotImplemented),
+                ErrorDetails{Status: http.StatusNotImplemented})
         }
     case serviceUnavailable:
         if v.seconds >= 0 {
@@ -153,7 +222,8 @@ func (c *webApp) writeResponse(w *wrappedWriter, r *http.Request, response *inte
             w.WriteHeader(http.StatusServiceUnavailable)
             c.marshalOutput(w, &v.body, ctx, templateName)
         } else {
-            http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+            c.httpError(w, r, ctx, http.StatusText(http.StatusServiceUnavailable),
+                ErrorDetails{Status: http.StatusServiceUnavailable})
         }
     case error:
         w.err = internalError{
@@ -161,8 +231,7 @@ func (c *webApp) writeResponse(w *wrappedWriter, r *http.Request, response *inte
             why: v.Error(),
             code: errorCode(v.Error()),
         }
-        http.Error(w, fmt.Sprintf("%s: %d", http.StatusText(http.StatusInternalServerError),
-            w.err.code), http.StatusInternalServerError)
+        c.httpError(w, r, ctx, internalErrorText(w), ErrorDetails{Status: http.StatusInternalServerError, Code: w.err.code})
     case io.ReadCloser:
         defer v.Close()
         if r.Header.Get("Range") != "" {